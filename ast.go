@@ -0,0 +1,323 @@
+package rematch
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pixeltopic/rematch/internal/stack"
+)
+
+// Node is a node in the abstract syntax tree of an expression.
+//
+// A Node is one of *AndNode, *OrNode, *NotNode, *NearNode, *WordNode, *PhraseNode or *PatternNode.
+// Nodes belonging to an Expr are shared by every evaluation of it and must not be modified.
+type Node interface {
+	node()
+}
+
+type (
+	// AndNode matches if every one of its operands match.
+	AndNode struct {
+		Nodes []Node
+	}
+
+	// OrNode matches if any of its operands match.
+	OrNode struct {
+		Nodes []Node
+	}
+
+	// NotNode matches if its operand does not match.
+	NotNode struct {
+		Node Node
+	}
+
+	// NearNode matches if its operands both occur within Distance word positions of each other.
+	// Left and Right are always a *WordNode matching a word exactly or a *PhraseNode.
+	NearNode struct {
+		Left     Node
+		Right    Node
+		Distance int
+	}
+
+	// WordNode matches a word delimited by word boundaries.
+	WordNode struct {
+		Word  string
+		Fold  bool // match case-insensitively
+		Edits int  // match any word within this many edits of Word, as in colour~1; 0 to match Word exactly
+	}
+
+	// PhraseNode matches a sequence of words that appear consecutively and in order.
+	PhraseNode struct {
+		Words []string
+		Fold  bool // match case-insensitively
+	}
+
+	// PatternNode matches a pattern of wildcards against the entire text.
+	PatternNode struct {
+		Pattern string
+		Fold    bool // match case-insensitively
+
+		re *regexp.Regexp // precompiled pattern; may be nil if it was never compiled
+	}
+)
+
+func (*AndNode) node()     {}
+func (*OrNode) node()      {}
+func (*NotNode) node()     {}
+func (*NearNode) node()    {}
+func (*WordNode) node()    {}
+func (*PhraseNode) node()  {}
+func (*PatternNode) node() {}
+
+// Parse parses a raw expression into its abstract syntax tree.
+func Parse(rawExpr string, opts ...ExprOption) (Node, error) {
+	return NewExpr(rawExpr, opts...).compile()
+}
+
+// tokNode returns the leaf node of a word, phrase or pattern token.
+func tokNode(tok token) Node {
+	switch {
+	case tok.Phrase:
+		return &PhraseNode{Words: phraseWords(tok), Fold: tok.folded()}
+	case tok.Regex:
+		return &PatternNode{Pattern: tok.term(), Fold: tok.folded(), re: tok.re}
+	}
+	return &WordNode{Word: tok.term(), Fold: tok.folded(), Edits: tok.edits()}
+}
+
+// leafToken returns the token form of a leaf node. It is the zero token for any other node.
+func leafToken(n Node) token {
+	var tok token
+	switch n := n.(type) {
+	case *WordNode:
+		tok = token{Str: n.Word + fuzzySuffix(n.Edits)}
+	case *PhraseNode:
+		tok = token{Str: string(opPhrase) + strings.Join(n.Words, " ") + string(opPhrase), Phrase: true}
+	case *PatternNode:
+		tok = token{Str: n.Pattern, Regex: true, re: n.re}
+	default:
+		return tok
+	}
+	if isFolded(n) {
+		tok.Str = string(opFold) + tok.Str
+	}
+	return tok
+}
+
+// isFolded returns whether a leaf node is matched case-insensitively.
+func isFolded(n Node) bool {
+	switch n := n.(type) {
+	case *WordNode:
+		return n.Fold
+	case *PhraseNode:
+		return n.Fold
+	case *PatternNode:
+		return n.Fold
+	}
+	return false
+}
+
+// isFuzzy returns whether a node is a word matched within an edit distance.
+func isFuzzy(n Node) bool {
+	w, ok := n.(*WordNode)
+	return ok && w.Edits > 0
+}
+
+// walk calls f for n and every node below it, in depth-first order.
+func walk(n Node, f func(Node)) {
+	f(n)
+	switch n := n.(type) {
+	case *AndNode:
+		for _, c := range n.Nodes {
+			walk(c, f)
+		}
+	case *OrNode:
+		for _, c := range n.Nodes {
+			walk(c, f)
+		}
+	case *NotNode:
+		walk(n.Node, f)
+	case *NearNode:
+		walk(n.Left, f)
+		walk(n.Right, f)
+	}
+}
+
+// foldNode marks every word, phrase and pattern below n as case-insensitive.
+// Patterns must be compiled afterwards.
+func foldNode(n Node) {
+	walk(n, func(n Node) {
+		switch n := n.(type) {
+		case *WordNode:
+			n.Fold = true
+		case *PhraseNode:
+			n.Fold = true
+		case *PatternNode:
+			n.Fold, n.re = true, nil
+		}
+	})
+}
+
+// compileNode precompiles the pattern of every pattern node below n.
+func compileNode(n Node) error {
+	var err error
+	walk(n, func(n Node) {
+		if p, ok := n.(*PatternNode); ok && err == nil {
+			tok := leafToken(p)
+			if err = tok.compile(); err == nil {
+				p.re = tok.re
+			}
+		}
+	})
+	return err
+}
+
+// rpnTokens converts a tree into tokens in Reverse Polish notation.
+// An operand is marked as negated if it is below an odd number of NOT operators.
+func rpnTokens(n Node) []token {
+	var out []token
+	appendRPN(&out, n, false)
+	return out
+}
+
+func appendRPN(out *[]token, n Node, negated bool) {
+	switch n := n.(type) {
+	case *AndNode:
+		for i, c := range n.Nodes {
+			appendRPN(out, c, negated)
+			if i > 0 {
+				*out = append(*out, token{Str: string(opAnd)})
+			}
+		}
+	case *OrNode:
+		for i, c := range n.Nodes {
+			appendRPN(out, c, negated)
+			if i > 0 {
+				*out = append(*out, token{Str: string(opOr)})
+			}
+		}
+	case *NotNode:
+		appendRPN(out, n.Node, !negated)
+		*out = append(*out, token{Str: string(opNot)})
+	case *NearNode:
+		appendRPN(out, n.Left, negated)
+		appendRPN(out, n.Right, negated)
+		*out = append(*out, nearTok(n.Distance))
+	default:
+		tok := leafToken(n)
+		tok.Negate = negated
+		*out = append(*out, tok)
+	}
+}
+
+// rpnToNode converts tokens in Reverse Polish notation into a tree.
+// An EvalError is returned if the tokens are not in proper RPN, or if an operand or proximity operator is malformed,
+// since the tokens may come from JSON rather than from parsing an expression.
+func rpnToNode(rpnTokens []token) (Node, error) {
+	argStack := stack.New() // stack of Nodes
+
+	for _, tok := range rpnTokens {
+		switch str := tok.Str; {
+		case str == string(opNot):
+			if argStack.Len() < 1 {
+				return nil, EvalError("less than 1 argument in stack; likely syntax error in RPN")
+			}
+			argStack.Push(&NotNode{Node: argStack.Pop().(Node)})
+		case str == string(opAnd) || str == string(opOr):
+			if argStack.Len() < 2 {
+				return nil, EvalError("less than 2 arguments in stack; likely syntax error in RPN")
+			}
+			b, a := argStack.Pop().(Node), argStack.Pop().(Node)
+			if str == string(opAnd) {
+				argStack.Push(&AndNode{Nodes: []Node{a, b}})
+			} else {
+				argStack.Push(&OrNode{Nodes: []Node{a, b}})
+			}
+		case isNearOp(str):
+			if argStack.Len() < 2 {
+				return nil, EvalError("less than 2 arguments in stack; likely syntax error in RPN")
+			}
+			b, a := argStack.Pop().(Node), argStack.Pop().(Node)
+			if !isNearOperand(a) || !isNearOperand(b) {
+				return nil, EvalError("proximity operands must be words or phrases; likely syntax error in RPN")
+			}
+			if n, err := strconv.Atoi(str[1 : len(str)-1]); err != nil || n < 0 {
+				return nil, EvalError("invalid proximity operator; likely syntax error in RPN")
+			}
+			argStack.Push(&NearNode{Left: a, Right: b, Distance: nearDistance(str)})
+		default:
+			if err := checkLeaf(tok); err != nil {
+				return nil, err
+			}
+			argStack.Push(tokNode(tok))
+		}
+	}
+
+	if argStack.Len() != 1 {
+		return nil, EvalError("invalid element count in stack at end of evaluation")
+	}
+	return argStack.Pop().(Node), nil
+}
+
+// checkLeaf returns an EvalError if a word, phrase or pattern token could not have been parsed from an expression.
+func checkLeaf(tok token) error {
+	switch {
+	case tok.Phrase:
+		if len(phraseWords(tok)) == 0 {
+			return EvalError("empty phrase; likely syntax error in RPN")
+		}
+	case tok.term() == "":
+		return EvalError("empty word or pattern; likely syntax error in RPN")
+	case fuzzyOffset(tok) >= 0:
+		if n, err := strconv.Atoi(tok.Str[fuzzyOffset(tok)+1:]); err != nil || n < 0 {
+			return EvalError("invalid fuzzy modifier; likely syntax error in RPN")
+		}
+	}
+	return nil
+}
+
+// isNearOperand returns whether a node may be an operand of a proximity operator.
+func isNearOperand(n Node) bool {
+	switch n.(type) {
+	case *WordNode:
+		// a fuzzy word cannot be written as an operand, since ~1~ would be the proximity operator of colour~1~2~moon
+		return !isFuzzy(n)
+	case *PhraseNode:
+		return true
+	}
+	return false
+}
+
+// cloneNode returns a deep copy of a tree.
+func cloneNode(n Node) Node {
+	switch n := n.(type) {
+	case *AndNode:
+		return &AndNode{Nodes: cloneNodes(n.Nodes)}
+	case *OrNode:
+		return &OrNode{Nodes: cloneNodes(n.Nodes)}
+	case *NotNode:
+		return &NotNode{Node: cloneNode(n.Node)}
+	case *NearNode:
+		return &NearNode{Left: cloneNode(n.Left), Right: cloneNode(n.Right), Distance: n.Distance}
+	case *WordNode:
+		c := *n
+		return &c
+	case *PhraseNode:
+		c := *n
+		c.Words = append([]string(nil), n.Words...)
+		return &c
+	case *PatternNode:
+		c := *n
+		return &c
+	}
+	return n
+}
+
+func cloneNodes(nodes []Node) []Node {
+	out := make([]Node, len(nodes))
+	for i, n := range nodes {
+		out[i] = cloneNode(n)
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package rematch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testParseEntry parses an expression and compares its tree, rendered by testNodeStr.
+type testParseEntry struct {
+	in   string
+	opts []ExprOption
+	out  string
+}
+
+// testNodeStr renders a tree compactly, such as and(cow,not(moon)).
+func testNodeStr(n Node) string {
+	var children []Node
+	var name string
+	switch n := n.(type) {
+	case *AndNode:
+		name, children = "and", n.Nodes
+	case *OrNode:
+		name, children = "or", n.Nodes
+	case *NotNode:
+		name, children = "not", []Node{n.Node}
+	case *NearNode:
+		name, children = fmt.Sprintf("near%d", n.Distance), []Node{n.Left, n.Right}
+	case *WordNode, *PhraseNode, *PatternNode:
+		tok := leafToken(n)
+		if _, ok := n.(*PatternNode); ok {
+			return "pattern:" + tok.Str
+		}
+		return tok.Str
+	default:
+		return "nil"
+	}
+
+	var s []string
+	for _, c := range children {
+		s = append(s, testNodeStr(c))
+	}
+	return name + "(" + strings.Join(s, ",") + ")"
+}
+
+func TestParse(t *testing.T) {
+	entries := []testParseEntry{
+		{in: "cow", out: "cow"},
+		{in: "((cow))", out: "cow"},
+		{in: "cow+moon|jolly", out: "or(and(cow,moon),jolly)"},
+		{in: "cow+(moon*|!jolly)", out: "and(cow,or(pattern:moon*,not(jolly)))"},
+		{in: "!!cow", out: "not(not(cow))"},
+		{in: "!(cow+!moon)", out: "not(and(cow,not(moon)))"},
+		{in: `cow~2~"over the"+^moon`, out: `and(near2(cow,"over the"),^moon)`},
+		{in: "!cow~1~moon", out: "not(near1(cow,moon))"},
+		{in: "cow+moon*", opts: []ExprOption{IgnoreCase()}, out: "and(^cow,pattern:^moon*)"},
+	}
+
+	for i, entry := range entries {
+		root, err := Parse(entry.in, entry.opts...)
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if out := testNodeStr(root); out != entry.out {
+			t.Errorf("test #%d should have out=%s, but out=%s", i+1, entry.out, out)
+		}
+
+		// the RPN view must convert back into the same tree
+		back, err := rpnToNode(rpnTokens(root))
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+		} else if out := testNodeStr(back); out != entry.out {
+			t.Errorf("test #%d should have out=%s after RPN, but out=%s", i+1, entry.out, out)
+		}
+	}
+
+	if _, err := Parse("cow+"); !errors.Is(err, SyntaxError("unexpected operator at end of expression, want operand")) {
+		t.Errorf("should have failed to parse, but err=%v", err)
+	}
+}
+
+func TestNegatedStrings(t *testing.T) {
+	const text = "the cow jumped over the moon"
+
+	entries := []testEntry{
+		{in: "!!cow", evalRPN: []testEvalEntry{{text: text, shouldMatch: true, strs: []string{"cow"}}}},
+		{in: "!!!jolly", evalRPN: []testEvalEntry{{text: text, shouldMatch: true}}},
+		{in: "!(!cow|jolly)", evalRPN: []testEvalEntry{{text: text, shouldMatch: true, strs: []string{"cow"}}}},
+		{in: "!(jolly+!(cow+moon))", evalRPN: []testEvalEntry{{text: text, shouldMatch: true, strs: []string{"cow", "moon"}}}},
+		{in: "cow+!(!moon)+!(jolly)", evalRPN: []testEvalEntry{{text: text, shouldMatch: true, strs: []string{"cow", "moon"}}}},
+	}
+
+	for i, entry := range entries {
+		for j, evalEntry := range entry.evalRPN {
+			res, err := RawExprFindAll(entry.in, evalEntry.text)
+			if err != nil {
+				t.Errorf("test #%d:%d should have err=nil, but err=%v", i+1, j+1, err)
+			} else if res.Match != evalEntry.shouldMatch {
+				t.Errorf("test #%d:%d should have res=%v, but res=%v", i+1, j+1, evalEntry.shouldMatch, res.Match)
+			} else if !testUnorderedSliceEq(res.Strings, evalEntry.strs) {
+				t.Errorf("test #%d:%d should have res=%v, but res=%v", i+1, j+1, evalEntry.strs, res.Strings)
+			}
+		}
+	}
+}
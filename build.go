@@ -0,0 +1,187 @@
+package rematch
+
+import (
+	"strings"
+)
+
+// Word returns an expression matching a single word, which must consist of letters and digits only.
+//
+// Word and the other builder functions produce a compiled expression whose raw form, as returned by Expr.Raw,
+// is the canonical syntax of the built expression. A problem found while building an expression is returned
+// when it is compiled or evaluated, and is passed on by any expression built from it.
+func Word(word string) *Expr {
+	if err := checkTerm(word, false); err != nil {
+		return &Expr{err: err}
+	}
+	return build(&WordNode{Word: word})
+}
+
+// Fuzzy returns an expression matching any word within n edits of a word, where an edit inserts, deletes or
+// substitutes a character, or transposes two adjacent characters. The word must consist of letters and digits only.
+// If n is 0, the word is matched exactly as it is by Word.
+func Fuzzy(word string, n int) *Expr {
+	if n < 0 {
+		return &Expr{err: SyntaxError("invalid fuzzy modifier; want ~n")}
+	}
+	if err := checkTerm(word, false); err != nil {
+		return &Expr{err: err}
+	}
+	return build(&WordNode{Word: word, Edits: n})
+}
+
+// Phrase returns an expression matching words that appear consecutively and in order.
+// Each word must consist of letters and digits only.
+func Phrase(words ...string) *Expr {
+	if len(words) == 0 {
+		return &Expr{err: SyntaxError("invalid phrase; must contain at least one word")}
+	}
+	for _, w := range words {
+		if err := checkTerm(w, false); err != nil {
+			return &Expr{err: err}
+		}
+	}
+	return build(&PhraseNode{Words: append([]string(nil), words...)})
+}
+
+// Pattern returns an expression matching a pattern of letters, digits and at least one wildcard.
+// Adjacent wildcards are collapsed as they are in a raw expression.
+func Pattern(pattern string) *Expr {
+	if err := checkTerm(pattern, true); err != nil {
+		return &Expr{err: err}
+	}
+	toks, err := tokenizeExpr(pattern)
+	if err != nil {
+		return &Expr{err: withExpr(err, pattern)}
+	}
+	n := &PatternNode{Pattern: toks[0].Str}
+	if err := compileNode(n); err != nil {
+		return &Expr{err: err}
+	}
+	return build(n)
+}
+
+// And returns an expression matching if every one of exprs match.
+func And(exprs ...*Expr) *Expr {
+	nodes, err := buildOperands(exprs)
+	if err != nil {
+		return &Expr{err: err}
+	}
+	if len(nodes) == 1 {
+		return build(nodes[0])
+	}
+	return build(&AndNode{Nodes: nodes})
+}
+
+// Or returns an expression matching if any of exprs match.
+func Or(exprs ...*Expr) *Expr {
+	nodes, err := buildOperands(exprs)
+	if err != nil {
+		return &Expr{err: err}
+	}
+	if len(nodes) == 1 {
+		return build(nodes[0])
+	}
+	return build(&OrNode{Nodes: nodes})
+}
+
+// Not returns an expression matching if expr does not match.
+func Not(expr *Expr) *Expr {
+	nodes, err := buildOperands([]*Expr{expr})
+	if err != nil {
+		return &Expr{err: err}
+	}
+	return build(&NotNode{Node: nodes[0]})
+}
+
+// Near returns an expression matching if a and b both occur within n word positions of each other.
+// a and b must each be a word or a phrase, and a word must not be fuzzy.
+func Near(a, b *Expr, n int) *Expr {
+	if n < 0 {
+		return &Expr{err: SyntaxError("invalid proximity operator; want ~n~")}
+	}
+	nodes, err := buildOperands([]*Expr{a, b})
+	if err != nil {
+		return &Expr{err: err}
+	}
+	if isFuzzy(nodes[0]) || isFuzzy(nodes[1]) {
+		return &Expr{err: errFuzzyNear}
+	}
+	if !isNearOperand(nodes[0]) || !isNearOperand(nodes[1]) {
+		return &Expr{err: SyntaxError("invalid proximity operand; must be a word or phrase")}
+	}
+	return build(&NearNode{Left: nodes[0], Right: nodes[1], Distance: n})
+}
+
+// Fold returns a copy of expr whose words, phrases and patterns are all matched case-insensitively.
+func Fold(expr *Expr) *Expr {
+	nodes, err := buildOperands([]*Expr{expr})
+	if err != nil {
+		return &Expr{err: err}
+	}
+	root := cloneNode(nodes[0])
+	foldNode(root)
+	if err := compileNode(root); err != nil {
+		return &Expr{err: err}
+	}
+	return build(root)
+}
+
+// build returns a compiled expression of a tree.
+func build(root Node) *Expr {
+	e := &Expr{raw: formatNode(root)}
+	e.state.Store(&exprState{root: root, rpn: rpnTokens(root)})
+	return e
+}
+
+// buildOperands compiles exprs and returns their trees. The trees are shared rather than copied, since they are never modified.
+func buildOperands(exprs []*Expr) ([]Node, error) {
+	if len(exprs) == 0 {
+		return nil, SyntaxError("missing operand")
+	}
+	nodes := make([]Node, len(exprs))
+	for i, e := range exprs {
+		if e == nil {
+			return nil, SyntaxError("missing operand")
+		}
+		root, err := e.compile()
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = root
+	}
+	return nodes, nil
+}
+
+// checkTerm validates a word for the builder, or a pattern if pattern is true.
+// Problems are returned as a *ParseError locating them in s.
+func checkTerm(s string, pattern bool) error {
+	fail := func(err SyntaxError, offset int, tok, expected string) error {
+		perr := newParseError(err, offset, tok, expected)
+		perr.Expr = s
+		return perr
+	}
+
+	if s == "" {
+		return fail(SyntaxError("invalid word; must contain at least one letter or digit"), 0, "", "a letter or digit")
+	}
+	var alphaNum, wildcard bool
+	for i, c := range s {
+		switch {
+		case allowedWordChars(c):
+			alphaNum = true
+		case strings.ContainsRune(string(opWildcardAst)+string(opWildcardQstn)+string(opWildcardSpce), c) && pattern:
+			wildcard = true
+		case pattern:
+			return fail(SyntaxError("invalid char in pattern; must be alphanumeric or a wildcard"), i, string(c), "a letter, digit or wildcard")
+		default:
+			return fail(SyntaxError("invalid char in word; must be alphanumeric"), i, string(c), "a letter or digit")
+		}
+	}
+	if !alphaNum {
+		return fail(SyntaxError("invalid word; cannot only contain wildcards"), 0, s, "a letter or digit")
+	}
+	if pattern && !wildcard {
+		return fail(SyntaxError("invalid pattern; must contain a wildcard"), 0, s, "a wildcard")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package rematch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testBuildEntry compares an expression built programmatically with the raw expression it should be equivalent to.
+type testBuildEntry struct {
+	expr *Expr
+	raw  string // canonical raw expression
+	err  error
+}
+
+func TestBuild(t *testing.T) {
+	entries := []testBuildEntry{
+		{expr: Word("cow"), raw: "cow"},
+		{expr: Word("café"), raw: "café"},
+		{expr: Pattern("moon**"), raw: "moon*"},
+		{expr: Phrase("farmers", "market"), raw: `"farmers market"`},
+		{
+			expr: And(Word("cow"), Or(Pattern("moon*"), Not(Word("jolly")))),
+			raw:  "cow+(moon*|!jolly)",
+		},
+		{expr: And(Word("cow"), Word("moon"), Word("over")), raw: "cow+moon+over"},
+		{expr: And(Or(Word("cow"), Word("moon")), Word("over")), raw: "(cow|moon)+over"},
+		{expr: Or(Word("cow"), Or(Word("moon"), Word("over"))), raw: "cow|(moon|over)"},
+		{expr: Or(Word("cow")), raw: "cow"},
+		{expr: Not(And(Word("cow"), Word("moon"))), raw: "!(cow+moon)"},
+		{expr: Not(Not(Word("cow"))), raw: "!!cow"},
+		{expr: And(Near(Word("cow"), Phrase("the", "moon"), 3), Word("over")), raw: `cow~3~"the moon"+over`},
+		{expr: Fold(And(Word("cow"), Pattern("moon*"))), raw: "^cow+^moon*"},
+		{expr: And(NewExpr("cow|moon"), Word("over")), raw: "(cow|moon)+over"},
+		{expr: Fold(Or(Fuzzy("colour", 1), Fuzzy("cow", 0))), raw: "^colour~1|^cow"},
+
+		{expr: Word("cow+moon"), err: SyntaxError("invalid char in word; must be alphanumeric")},
+		{expr: Word("moon*"), err: SyntaxError("invalid char in word; must be alphanumeric")},
+		{expr: Word(""), err: SyntaxError("invalid word; must contain at least one letter or digit")},
+		{expr: Pattern("moon"), err: SyntaxError("invalid pattern; must contain a wildcard")},
+		{expr: Pattern("**"), err: SyntaxError("invalid word; cannot only contain wildcards")},
+		{expr: Phrase(), err: SyntaxError("invalid phrase; must contain at least one word")},
+		{expr: Phrase("farmers market"), err: SyntaxError("invalid char in word; must be alphanumeric")},
+		{expr: And(), err: SyntaxError("missing operand")},
+		{expr: Or(Word("cow"), nil), err: SyntaxError("missing operand")},
+		{expr: And(Word("cow"), Not(Word("moon?!"))), err: SyntaxError("invalid char in word; must be alphanumeric")},
+		{expr: Near(Word("cow"), Pattern("moon*"), 1), err: SyntaxError("invalid proximity operand; must be a word or phrase")},
+		{expr: Near(Word("cow"), Word("moon"), -1), err: SyntaxError("invalid proximity operator; want ~n~")},
+		{expr: Near(Fuzzy("cow", 1), Word("moon"), 1), err: SyntaxError("invalid proximity operand; cannot be a fuzzy word")},
+		{expr: Fuzzy("cow", -1), err: SyntaxError("invalid fuzzy modifier; want ~n")},
+		{expr: Fuzzy("cow*", 1), err: SyntaxError("invalid char in word; must be alphanumeric")},
+		{expr: Or(Word("cow"), NewExpr("moon+")), err: SyntaxError("unexpected operator at end of expression, want operand")},
+	}
+
+	for i, entry := range entries {
+		err := entry.expr.Compile()
+		if entry.err != nil {
+			if !errors.Is(err, entry.err) {
+				t.Errorf("test #%d should have err=%v, but err=%v", i+1, entry.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if raw := entry.expr.Raw(); raw != entry.raw {
+			t.Errorf("test #%d should have raw=%s, but raw=%s", i+1, entry.raw, raw)
+		}
+
+		// the canonical raw expression must compile into the same RPN form
+		expected := NewExpr(entry.raw)
+		if err := expected.Compile(); err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if rpn, expectedRPN := strings.Join(entry.expr.RPN(), ","), strings.Join(expected.RPN(), ","); rpn != expectedRPN {
+			t.Errorf("test #%d should have rpn=%s, but rpn=%s", i+1, expectedRPN, rpn)
+		}
+	}
+}
+
+func TestBuildEval(t *testing.T) {
+	expr := And(Word("cow"), Or(Pattern("moon*"), Not(Word("jolly"))))
+
+	res, err := ExprFindAll(expr, "The cow jumped over the moon")
+	if err != nil {
+		t.Fatalf("should have err=nil, but err=%v", err)
+	}
+	if !res.Match || !testUnorderedSliceEq(res.Strings, []string{"cow", "moon"}) {
+		t.Errorf("should have res=[cow moon], but res=%v", res.Strings)
+	}
+
+	if ok, err := EvalExpr(expr, "the jolly cow"); err != nil || ok {
+		t.Errorf("should have res=false, but res=%v, err=%v", ok, err)
+	}
+}
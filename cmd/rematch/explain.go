@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pixeltopic/rematch"
+)
+
+// runExplain prints how an expression is evaluated against a file, or stdin if there is none, operator by operator.
+// The exit status is 0 if the expression matched, 1 if it did not, and 2 if an error occurred.
+func runExplain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rematch explain [-i] [--json] expression [file]")
+		fs.PrintDefaults()
+	}
+	ignoreCase := fs.Bool("i", false, "match case-insensitively")
+	asJSON := fs.Bool("json", false, "print the trace as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var opts []rematch.ExprOption
+	if *ignoreCase {
+		opts = append(opts, rematch.IgnoreCase())
+	}
+	expr := rematch.NewExpr(fs.Arg(0), opts...)
+	if err := expr.Compile(); err != nil {
+		printErr(stderr, err)
+		return 2
+	}
+
+	r := stdin
+	if fs.NArg() == 2 {
+		f, err := os.Open(fs.Arg(1))
+		if err != nil {
+			fmt.Fprintln(stderr, "rematch:", err)
+			return 2
+		}
+		defer f.Close()
+		r = f
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		fmt.Fprintln(stderr, "rematch:", err)
+		return 2
+	}
+
+	trace, err := rematch.Explain(expr, rematch.NewText(string(b)))
+	if err != nil {
+		printErr(stderr, err)
+		return 2
+	}
+	if *asJSON {
+		b, err := json.Marshal(trace)
+		if err != nil {
+			fmt.Fprintln(stderr, "rematch:", err)
+			return 2
+		}
+		fmt.Fprintln(stdout, string(b))
+	} else {
+		fmt.Fprint(stdout, trace)
+	}
+
+	if !trace.Match {
+		return 1
+	}
+	return 0
+}
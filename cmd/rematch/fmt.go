@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pixeltopic/rematch"
+)
+
+// runFmt prints each expression given as an argument in canonical form, or each line of stdin if there are none.
+// The exit status is 1 if any expression is malformed.
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rematch fmt [-i] [-O] [expression ...]")
+		fs.PrintDefaults()
+	}
+	ignoreCase := fs.Bool("i", false, "write every word, phrase and pattern as case-insensitive")
+	optimize := fs.Bool("O", false, "simplify expressions")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var opts []rematch.ExprOption
+	if *ignoreCase {
+		opts = append(opts, rematch.IgnoreCase())
+	}
+	if *optimize {
+		opts = append(opts, rematch.Optimize())
+	}
+
+	exprs := fs.Args()
+	if len(exprs) == 0 {
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				exprs = append(exprs, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			printErr(stderr, err)
+			return 2
+		}
+	}
+
+	status := 0
+	for _, raw := range exprs {
+		out, err := rematch.Format(rematch.NewExpr(raw, opts...))
+		if err != nil {
+			printErr(stderr, err)
+			status = 1
+			continue
+		}
+		fmt.Fprintln(stdout, out)
+	}
+	return status
+}
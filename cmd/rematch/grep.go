@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pixeltopic/rematch"
+)
+
+// units into which grep splits its input, each of which is matched as a rematch.Text
+const (
+	modeLine      = "line"
+	modeParagraph = "paragraph"
+	modeFile      = "file"
+)
+
+// stdinName is the name of standard input in output.
+const stdinName = "(standard input)"
+
+// grepOptions are the options of a grep command.
+type grepOptions struct {
+	invert bool
+	count  bool
+	list   bool
+	json   bool
+	mode   string
+	names  bool // prefix output with file names
+}
+
+// grepMatch is the JSON output of a matching unit.
+type grepMatch struct {
+	File   string          `json:"file"`
+	Unit   int             `json:"unit"` // line or paragraph number, starting from 1
+	Text   string          `json:"text"`
+	Result *rematch.Result `json:"result"`
+}
+
+// runGrep prints the units of each file, or stdin if there are none, that match an expression.
+// The exit status is 0 if any unit was selected, 1 if none were, and 2 if an error occurred.
+func runGrep(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("grep", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rematch [grep] [-v] [-c] [-l] [-i] [--json] [--mode=line|paragraph|file] expression [file ...]")
+		fs.PrintDefaults()
+	}
+	var opts grepOptions
+	fs.BoolVar(&opts.invert, "v", false, "select units that do not match")
+	fs.BoolVar(&opts.count, "c", false, "print the number of selected units of each file")
+	fs.BoolVar(&opts.list, "l", false, "print the names of files with a selected unit")
+	fs.BoolVar(&opts.json, "json", false, "print each selected unit and its result as a line of JSON")
+	fs.StringVar(&opts.mode, "mode", modeLine, "unit matched as a text: line, paragraph or file")
+	ignoreCase := fs.Bool("i", false, "match case-insensitively")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	switch opts.mode {
+	case modeLine, modeParagraph, modeFile:
+	default:
+		fmt.Fprintf(stderr, "rematch: invalid mode %q\n", opts.mode)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var exprOpts []rematch.ExprOption
+	if *ignoreCase {
+		exprOpts = append(exprOpts, rematch.IgnoreCase())
+	}
+	expr := rematch.NewExpr(fs.Arg(0), exprOpts...)
+	if err := expr.Compile(); err != nil {
+		printErr(stderr, err)
+		return 2
+	}
+
+	files := fs.Args()[1:]
+	opts.names = len(files) > 1
+
+	status := 1
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		selected, err := grepFile(expr, name, stdin, stdout, opts)
+		if err != nil {
+			fmt.Fprintln(stderr, "rematch:", err)
+			status = 2
+			continue
+		}
+		if selected && status == 1 {
+			status = 0
+		}
+	}
+	return status
+}
+
+// grepFile matches the units of a file, or stdin if name is "-", and prints the output for it.
+// It returns whether any unit was selected.
+func grepFile(expr *rematch.Expr, name string, stdin io.Reader, stdout io.Writer, opts grepOptions) (bool, error) {
+	var r io.Reader = stdin
+	if name == "-" {
+		name = stdinName
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var (
+		selected int
+		out      = bufio.NewWriter(stdout)
+	)
+
+	// match matches a unit and writes it if it is selected, returning whether to continue with the next unit
+	match := func(n int, unit string) (bool, error) {
+		// only the outcome is needed to count or list, so evaluation may short-circuit
+		var res *rematch.Result
+		if opts.count || opts.list {
+			ok, err := rematch.Eval(expr, rematch.NewText(unit))
+			if err != nil {
+				return false, err
+			}
+			res = &rematch.Result{Match: ok}
+		} else {
+			var err error
+			if res, err = rematch.FindAll(expr, rematch.NewText(unit)); err != nil {
+				return false, err
+			}
+		}
+		if res.Match == opts.invert {
+			return true, nil
+		}
+
+		selected++
+		switch {
+		case opts.list:
+			return false, nil // one selected unit is enough to list the file
+		case opts.count:
+		case opts.json:
+			b, err := json.Marshal(&grepMatch{File: name, Unit: n, Text: unit, Result: res})
+			if err != nil {
+				return false, err
+			}
+			_, _ = out.Write(b)
+			_ = out.WriteByte('\n')
+		default:
+			writeUnit(out, name, unit, opts)
+		}
+		return true, nil
+	}
+
+	var err error
+	if opts.mode == modeFile && (opts.count || opts.list) {
+		// the file is not printed, so it is streamed rather than read into memory
+		var ok bool
+		if ok, err = rematch.EvalReader(expr, r); err == nil && ok != opts.invert {
+			selected = 1
+		}
+	} else {
+		err = eachUnit(r, opts.mode, match)
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+
+	switch {
+	case opts.list:
+		if selected > 0 {
+			fmt.Fprintln(out, name)
+		}
+	case opts.count:
+		if opts.names {
+			fmt.Fprintf(out, "%s:", name)
+		}
+		fmt.Fprintln(out, selected)
+	}
+	return selected > 0, out.Flush()
+}
+
+// writeUnit writes a selected unit, prefixing each of its lines with the file name if there are many files.
+// Paragraphs are separated by a blank line.
+func writeUnit(w *bufio.Writer, name, unit string, opts grepOptions) {
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(unit, "\n"), "\n") {
+		if opts.names {
+			_, _ = w.WriteString(name + ":")
+		}
+		_, _ = w.WriteString(strings.TrimSuffix(line, "\n"))
+		_ = w.WriteByte('\n')
+	}
+	if opts.mode == modeParagraph {
+		_ = w.WriteByte('\n')
+	}
+}
+
+// eachUnit calls fn with each unit read from r, numbered from 1, until it returns false or an error.
+// Lines do not include their line ending, and paragraphs are separated by lines containing only whitespace.
+func eachUnit(r io.Reader, mode string, fn func(n int, unit string) (bool, error)) error {
+	if mode == modeFile {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = fn(1, string(b))
+		return err
+	}
+
+	var (
+		br        = bufio.NewReader(r)
+		n         int
+		paragraph strings.Builder
+	)
+	// flush calls fn with the paragraph read so far, if any
+	flush := func() (bool, error) {
+		if paragraph.Len() == 0 {
+			return true, nil
+		}
+		n++
+		defer paragraph.Reset()
+		return fn(n, paragraph.String())
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		var more bool
+		var fnErr error
+		switch {
+		case mode == modeLine:
+			n++
+			more, fnErr = fn(n, line)
+		case strings.TrimSpace(line) == "":
+			more, fnErr = flush()
+		default:
+			if paragraph.Len() > 0 {
+				paragraph.WriteByte('\n')
+			}
+			paragraph.WriteString(line)
+			more = true
+		}
+		if fnErr != nil || !more {
+			return fnErr
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	_, err := flush()
+	return err
+}
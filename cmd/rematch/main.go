@@ -0,0 +1,88 @@
+// Command rematch works with Rematch expressions from the command line.
+//
+// Usage:
+//
+//	rematch [grep flags] expression [file ...]
+//	rematch <command> [arguments]
+//
+// The commands are:
+//
+//	grep     print lines, paragraphs or files that match an expression
+//	fmt      print expressions in canonical form
+//	repl     match expressions against sample texts interactively
+//	explain  print how an expression is evaluated against a text
+//
+// If the first argument is not a command, the arguments are those of grep.
+// Use "rematch grep" explicitly to match an expression that is the name of a command.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pixeltopic/rematch"
+)
+
+// command is a subcommand of rematch.
+type command struct {
+	name  string
+	short string // one line description
+	run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+// commands are the subcommands of rematch, in the order they are listed in the usage message.
+var commands = []*command{
+	{name: "grep", short: "print lines, paragraphs or files that match an expression", run: runGrep},
+	{name: "fmt", short: "print expressions in canonical form", run: runFmt},
+	{name: "repl", short: "match expressions against sample texts interactively", run: runRepl},
+	{name: "explain", short: "print how an expression is evaluated against a text", run: runExplain},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs rematch with command line arguments and returns its exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+	return runGrep(args, stdin, stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: rematch [grep flags] expression [file ...]")
+	fmt.Fprintln(w, "       rematch <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The commands are:")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 4, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "\t%s\t%s\n", cmd.name, cmd.short)
+	}
+	_ = tw.Flush()
+}
+
+// printErr writes an error to w, rendering the expression with a caret under the problem if it is a *rematch.ParseError.
+func printErr(w io.Writer, err error) {
+	var perr *rematch.ParseError
+	if errors.As(err, &perr) {
+		fmt.Fprintln(w, perr.Caret())
+		return
+	}
+	fmt.Fprintln(w, "rematch:", err)
+}
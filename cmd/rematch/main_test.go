@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRunEntry runs rematch with arguments and stdin, and compares its output and exit status.
+type testRunEntry struct {
+	args   []string
+	stdin  string
+	stdout string
+	stderr string // prefix of stderr
+	status int
+}
+
+func testRun(t *testing.T, entries []testRunEntry) {
+	t.Helper()
+	for i, entry := range entries {
+		var stdout, stderr bytes.Buffer
+		status := run(entry.args, strings.NewReader(entry.stdin), &stdout, &stderr)
+		if status != entry.status {
+			t.Errorf("test #%d should have status=%d, but status=%d (stderr=%q)", i+1, entry.status, status, stderr.String())
+		}
+		if stdout.String() != entry.stdout {
+			t.Errorf("test #%d should have stdout=%q, but stdout=%q", i+1, entry.stdout, stdout.String())
+		}
+		if !strings.HasPrefix(stderr.String(), entry.stderr) {
+			t.Errorf("test #%d should have stderr=%q, but stderr=%q", i+1, entry.stderr, stderr.String())
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	testRun(t, []testRunEntry{
+		{args: nil, stderr: "usage: rematch", status: 2},
+		{args: []string{"frobnicate"}, stdin: "frobnicate the widget\n", stdout: "frobnicate the widget\n"},
+	})
+}
+
+func TestFmt(t *testing.T) {
+	testRun(t, []testRunEntry{
+		{args: []string{"fmt", "Apples|ostriches+apples", "((Apples))"}, stdout: "(Apples|ostriches)+apples\nApples\n"},
+		{args: []string{"fmt", "-i", "cow+moon*"}, stdout: "^cow+^moon*\n"},
+		{args: []string{"fmt", "-O", "!!(moon*+(cow+cow))"}, stdout: "cow+moon*\n"},
+		{args: []string{"fmt"}, stdin: "tasty__\n\n!(jolly)\n", stdout: "tasty_\n!jolly\n"},
+		{
+			args:   []string{"fmt", "cow++moon", "cow"},
+			stdout: "cow\n",
+			stderr: "cow++moon\n    ^ unexpected infix operator",
+			status: 1,
+		},
+		{args: []string{"fmt", "-x"}, stderr: "flag provided but not defined", status: 2},
+	})
+}
+
+// testWriteFiles writes files into a new temporary directory and returns their paths.
+func testWriteFiles(t *testing.T, files ...string) (string, []string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "rematch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for i, content := range files {
+		path := filepath.Join(dir, string(rune('a'+i))+".txt")
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return dir, paths
+}
+
+func TestGrep(t *testing.T) {
+	const (
+		poem = "The cow jumped over the moon.\nThe little dog laughed\n\nto see such fun,\nand the dish ran away with the spoon.\n"
+		farm = "The farmer's cow\nsleeps in the barn\n"
+	)
+	dir, paths := testWriteFiles(t, poem, farm)
+	defer os.RemoveAll(dir)
+	a, b := paths[0], paths[1]
+
+	testRun(t, []testRunEntry{
+		{args: []string{"cow"}, stdin: poem, stdout: "The cow jumped over the moon.\n"},
+		{args: []string{"grep", "cow"}, stdin: poem, stdout: "The cow jumped over the moon.\n"},
+		{args: []string{"fmt"}, stdin: "fmt\n", stdout: "fmt\n"},
+		{args: []string{"grep", "fmt"}, stdin: "go fmt\ngo vet\n", stdout: "go fmt\n"},
+		{args: []string{"-v", "the"}, stdin: poem, stdout: "The little dog laughed\n\nto see such fun,\n"},
+		{args: []string{"-i", "-c", "the"}, stdin: poem, stdout: "3\n"},
+		{args: []string{"jolly"}, stdin: poem, status: 1},
+		{args: []string{"--mode=paragraph", "dog|spoon"}, stdin: poem, stdout: "The cow jumped over the moon.\nThe little dog laughed\n\nto see such fun,\nand the dish ran away with the spoon.\n\n"},
+		{args: []string{"--mode=paragraph", "cow+dog"}, stdin: poem, stdout: "The cow jumped over the moon.\nThe little dog laughed\n\n"},
+		{args: []string{"--mode=file", "cow+spoon"}, stdin: poem, stdout: poem},
+		{args: []string{"cow", a, b}, stdout: a + ":The cow jumped over the moon.\n" + b + ":The farmer's cow\n"},
+		{args: []string{"-c", "cow", a, b}, stdout: a + ":1\n" + b + ":1\n"},
+		{args: []string{"-l", "barn", a, b}, stdout: b + "\n"},
+		{args: []string{"-l", "--mode=file", "cow+!spoon", a, b}, stdout: b + "\n"},
+		{args: []string{"-l", "-v", "--mode=file", "cow+!spoon", a, b}, stdout: a + "\n"},
+		{
+			args:   []string{"--json", "cow+moon*"},
+			stdin:  poem,
+			stdout: `{"file":"(standard input)","unit":1,"text":"The cow jumped over the moon.","result":{"Match":true,"Strings":["cow","moon"],"Spans":[{"Start":4,"End":7,"Token":"cow","Kind":"word"},{"Start":24,"End":28,"Token":"moon*","Kind":"pattern"}]}}` + "\n",
+		},
+		{args: []string{"cow", filepath.Join(dir, "missing.txt"), a}, stdout: a + ":The cow jumped over the moon.\n", stderr: "rematch: ", status: 2},
+		{args: []string{"cow++"}, stderr: "cow++\n", status: 2},
+		{args: []string{"--mode=word", "cow"}, stderr: `rematch: invalid mode "word"`, status: 2},
+		{args: []string{"-v"}, stderr: "usage: rematch [grep]", status: 2},
+	})
+}
+
+func TestRepl(t *testing.T) {
+	dir, paths := testWriteFiles(t, "The cow jumped over the moon.")
+	defer os.RemoveAll(dir)
+
+	input := strings.Join([]string{
+		"cow+moon*",
+		":text the jolly farmer",
+		"cow+moon*",
+		"!jolly|cow++",
+		":texts",
+		":use 1",
+		":history",
+		":redo 1",
+		":explain cow+!moon",
+		":use 9",
+		":frobnicate",
+		":quit",
+		"cow",
+	}, "\n")
+
+	expected := strings.Join([]string{
+		`text 1: ` + paths[0],
+		`Rematch REPL. Type ":help" for help.`,
+		`> rpn:     cow moon* +`,
+		`match:   true`,
+		`strings: ["cow" "moon"]`,
+		`> text 2: "the jolly farmer"`,
+		`> rpn:     cow moon* +`,
+		`match:   false`,
+		`> !jolly|cow++`,
+		`           ^ unexpected infix operator, want operand; expected word, phrase, pattern, '!' or '('`,
+		`!jolly|cow++`,
+		`            ^ unexpected operator at end of expression, want operand; expected word, phrase, pattern, '!' or '('`,
+		`>   1 ` + paths[0],
+		`* 2 "the jolly farmer"`,
+		`> > 1 cow+moon*`,
+		`2 cow+moon*`,
+		`3 !jolly|cow++`,
+		`> rpn:     cow moon* +`,
+		`match:   true`,
+		`strings: ["cow" "moon"]`,
+		`> and cow+!moon: false`,
+		`  word cow: true ["cow"]`,
+		`  not !moon: false, flipped from true`,
+		`    word moon: true ["moon"] (negated)`,
+		`> error: no text "9"`,
+		`> error: unknown command ":frobnicate"; type ":help" for help`,
+		`> `,
+	}, "\n")
+
+	testRun(t, []testRunEntry{
+		{args: append([]string{"repl"}, paths...), stdin: input, stdout: expected},
+		{args: []string{"repl"}, stdin: "cow", stdout: "Rematch REPL. Type \":help\" for help.\n> rpn:     cow\nno text loaded; use \":load FILE\" or \":text STRING\"\n> \n"},
+	})
+}
+
+func TestExplain(t *testing.T) {
+	dir, paths := testWriteFiles(t, "The cow jumped over the moon.")
+	defer os.RemoveAll(dir)
+
+	testRun(t, []testRunEntry{
+		{
+			args:   []string{"explain", "cow|!moon", paths[0]},
+			stdout: "or cow|!moon: true\n  word cow: true [\"cow\"]\n  not !moon: false, flipped from true\n    word moon: true [\"moon\"] (negated)\n",
+		},
+		{
+			args:   []string{"explain", "-i", "COW+farmer"},
+			stdin:  "the cow and the farmer",
+			stdout: "and ^COW+^farmer: true\n  word ^COW: true [\"cow\"]\n  word ^farmer: true [\"farmer\"]\n",
+		},
+		{args: []string{"explain", "farmer"}, stdin: "the cow", stdout: "word farmer: false\n", status: 1},
+		{
+			args:   []string{"explain", "--json", "cow"},
+			stdin:  "cow",
+			stdout: `{"Op":"word","Expr":"cow","Match":true,"Negated":false,"Strings":["cow"],"Spans":[{"Start":0,"End":3,"Token":"cow","Kind":"word"}]}` + "\n",
+		},
+		{args: []string{"explain", "cow+"}, stderr: "cow+\n", status: 2},
+		{args: []string{"explain", "cow", filepath.Join(dir, "missing")}, stderr: "rematch:", status: 2},
+		{args: []string{"explain"}, stderr: "usage: rematch explain", status: 2},
+	})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/pixeltopic/rematch"
+)
+
+// replHelp describes the commands of the REPL.
+const replHelp = `Type an expression to match it against the current text, or one of:
+  :load FILE     load a file as a text and make it current
+  :text STRING   add a string as a text and make it current
+  :texts         list the loaded texts
+  :use N         make text N current
+  :history       list the expressions entered so far
+  :redo N        match expression N of the history again
+  :explain EXPR  print how an expression is evaluated against the current text
+  :help          print this message
+  :quit          exit`
+
+// sample is a text loaded into the REPL.
+type sample struct {
+	name string
+	text *rematch.Text
+}
+
+// repl is the state of an interactive session.
+type repl struct {
+	out     io.Writer
+	opts    []rematch.ExprOption
+	samples []sample
+	current int // index in samples of the current text; -1 if none are loaded
+	history []string
+}
+
+// runRepl reads expressions and commands from stdin, one per line, and prints how each expression matches the current text.
+func runRepl(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rematch repl [-i] [file ...]")
+		fs.PrintDefaults()
+	}
+	ignoreCase := fs.Bool("i", false, "match case-insensitively")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	r := &repl{out: stdout, current: -1}
+	if *ignoreCase {
+		r.opts = append(r.opts, rematch.IgnoreCase())
+	}
+	for _, name := range fs.Args() {
+		if err := r.load(name); err != nil {
+			fmt.Fprintln(stderr, "rematch:", err)
+			return 2
+		}
+	}
+
+	fmt.Fprintln(stdout, `Rematch REPL. Type ":help" for help.`)
+	scanner := bufio.NewScanner(stdin)
+	for {
+		fmt.Fprint(stdout, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			break
+		}
+		if !r.exec(strings.TrimSpace(scanner.Text())) {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(stderr, "rematch:", err)
+		return 2
+	}
+	return 0
+}
+
+// exec executes a line of input, returning false if the session should end.
+func (r *repl) exec(line string) bool {
+	if line == "" {
+		return true
+	}
+	if line[0] != ':' {
+		r.history = append(r.history, line)
+		r.match(line)
+		return true
+	}
+
+	cmd, arg := line[1:], ""
+	if i := strings.IndexByte(cmd, ' '); i >= 0 {
+		cmd, arg = cmd[:i], strings.TrimSpace(cmd[i+1:])
+	}
+	switch cmd {
+	case "load":
+		if err := r.load(arg); err != nil {
+			fmt.Fprintln(r.out, "error:", err)
+		}
+	case "text":
+		r.add(strconv.Quote(arg), arg)
+	case "texts":
+		for i, s := range r.samples {
+			mark := " "
+			if i == r.current {
+				mark = "*"
+			}
+			fmt.Fprintf(r.out, "%s %d %s\n", mark, i+1, s.name)
+		}
+	case "use":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(r.samples) {
+			fmt.Fprintf(r.out, "error: no text %q\n", arg)
+			break
+		}
+		r.current = n - 1
+	case "history":
+		for i, expr := range r.history {
+			fmt.Fprintf(r.out, "%d %s\n", i+1, expr)
+		}
+	case "redo":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(r.history) {
+			fmt.Fprintf(r.out, "error: no expression %q in history\n", arg)
+			break
+		}
+		r.match(r.history[n-1])
+	case "explain":
+		r.explain(arg)
+	case "help":
+		fmt.Fprintln(r.out, replHelp)
+	case "quit", "q":
+		return false
+	default:
+		fmt.Fprintf(r.out, "error: unknown command %q; type \":help\" for help\n", line)
+	}
+	return true
+}
+
+// load adds the contents of a file as a text.
+func (r *repl) load(name string) error {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	r.add(name, string(b))
+	return nil
+}
+
+// add adds a text and makes it current.
+func (r *repl) add(name, s string) {
+	r.samples = append(r.samples, sample{name: name, text: rematch.NewText(s)})
+	r.current = len(r.samples) - 1
+	fmt.Fprintf(r.out, "text %d: %s\n", len(r.samples), name)
+}
+
+// match prints how an expression matches the current text, or every problem with the expression.
+func (r *repl) match(raw string) {
+	if errs := rematch.Validate(raw, r.opts...); len(errs) > 0 {
+		for _, err := range errs {
+			printErr(r.out, err)
+		}
+		return
+	}
+
+	expr := rematch.NewExpr(raw, r.opts...)
+	if err := expr.Compile(); err != nil {
+		printErr(r.out, err)
+		return
+	}
+	fmt.Fprintf(r.out, "rpn:     %s\n", strings.Join(expr.RPN(), " "))
+	if r.current < 0 {
+		fmt.Fprintln(r.out, `no text loaded; use ":load FILE" or ":text STRING"`)
+		return
+	}
+
+	res, err := rematch.FindAll(expr, r.samples[r.current].text)
+	if err != nil {
+		printErr(r.out, err)
+		return
+	}
+	fmt.Fprintf(r.out, "match:   %v\n", res.Match)
+	if res.Match {
+		fmt.Fprintf(r.out, "strings: %q\n", res.Strings)
+	}
+}
+
+// explain prints how an expression is evaluated against the current text, operator by operator.
+func (r *repl) explain(raw string) {
+	if r.current < 0 {
+		fmt.Fprintln(r.out, `no text loaded; use ":load FILE" or ":text STRING"`)
+		return
+	}
+	trace, err := rematch.Explain(rematch.NewExpr(raw, r.opts...), r.samples[r.current].text)
+	if err != nil {
+		printErr(r.out, err)
+		return
+	}
+	fmt.Fprint(r.out, trace)
+}
@@ -0,0 +1,311 @@
+package rematch
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FoldConfusables folds characters that look like ASCII letters and digits into them before a text is matched,
+// so that "hаte" written with a Cyrillic "а" matches "hate". This covers Cyrillic and Greek homoglyphs,
+// fullwidth and mathematical alphanumeric forms, and Latin letters with diacritics. Combining marks and
+// zero-width characters are removed. Words and phrases of an expression are folded the same way when they are matched,
+// so "café" and "Москва" still match themselves; patterns are matched against the folded text.
+//
+// Like every deobfuscation option, matched strings and spans of a Result refer to the text as it was written.
+func FoldConfusables() TextOption {
+	return func(c *textConfig) {
+		c.confusables = true
+	}
+}
+
+// JoinSplitLetters joins three or more single letters or digits separated by punctuation into one word before a text
+// is matched, so that "h.a.t.e" and "h-a-t-e" match "hate". Letters separated by whitespace are not joined,
+// and neither are sequences of digits alone, such as a version number.
+//
+// Like every deobfuscation option, matched strings and spans of a Result refer to the text as it was written.
+func JoinSplitLetters() TextOption {
+	return func(c *textConfig) {
+		c.join = true
+	}
+}
+
+// MapLeet replaces digits and symbols commonly substituted for letters in a word with those letters before a text is
+// matched, so that "h4te" and "$hame" match "hate" and "shame". Only words with a letter after a digit, or with a symbol,
+// are affected, so numbers and words whose digits all follow their letters, such as "mp3" or "ipv4", are left alone,
+// but a word such as "4ever" is changed as well.
+//
+// Like every deobfuscation option, matched strings and spans of a Result refer to the text as it was written.
+func MapLeet() TextOption {
+	return func(c *textConfig) {
+		c.leet = true
+	}
+}
+
+// CollapseRepeats collapses three or more repetitions of a letter into one before a text is matched,
+// so that "haaaate" matches "hate". Words rarely repeat a letter more than twice, so "good" is left alone,
+// but "goooood" becomes "god".
+//
+// Like every deobfuscation option, matched strings and spans of a Result refer to the text as it was written.
+func CollapseRepeats() TextOption {
+	return func(c *textConfig) {
+		c.collapse = true
+	}
+}
+
+// rewriter builds a string from another one, tracking the bytes of the original string that each byte came from,
+// so that offsets into the string built can be mapped back to the original.
+type rewriter struct {
+	src    string
+	lo, hi []int // range of the original string that each byte of src came from
+
+	b      strings.Builder
+	nlo    []int
+	nhi    []int
+	copied int // bytes of src written or replaced so far
+}
+
+// copy writes src[i:j].
+func (w *rewriter) copy(i, j int) {
+	w.b.WriteString(w.src[i:j])
+	w.nlo = append(w.nlo, w.lo[i:j]...)
+	w.nhi = append(w.nhi, w.hi[i:j]...)
+	w.copied = j
+}
+
+// replace writes s in place of src[i:j]; every byte of s comes from the original range of src[i:j].
+// If s is empty, src[i:j] is removed, and is considered to come with the last byte written, such as a combining mark
+// with the letter it follows.
+func (w *rewriter) replace(i, j int, s string) {
+	if s == "" && len(w.nhi) > 0 {
+		w.nhi[len(w.nhi)-1] = w.hi[j-1]
+	}
+	w.b.WriteString(s)
+	for range []byte(s) {
+		w.nlo = append(w.nlo, w.lo[i])
+		w.nhi = append(w.nhi, w.hi[j-1])
+	}
+	w.copied = j
+}
+
+// next makes the string built, along with its ranges in the original string, the source of the next stage,
+// keeping whatever was not rewritten.
+func (w *rewriter) next() {
+	w.copy(w.copied, len(w.src))
+	w.src, w.lo, w.hi = w.b.String(), w.nlo, w.nhi
+	w.b.Reset()
+	w.nlo, w.nhi, w.copied = nil, nil, 0
+}
+
+// deobfuscation is a normalized string that can be matched in place of the string it was rewritten from.
+type deobfuscation struct {
+	s      string
+	lo, hi []int // range of the original string that each byte of s came from
+}
+
+// deobfuscate applies each enabled deobfuscation stage to s, in an order where each stage benefits from the last:
+// homoglyphs become letters that may be split, split letters form words that may contain leetspeak,
+// and leetspeak may form repeated letters.
+func deobfuscate(s string, cfg textConfig) deobfuscation {
+	w := &rewriter{src: s, lo: make([]int, len(s)), hi: make([]int, len(s))}
+	for i := 0; i < len(s); i++ {
+		w.lo[i], w.hi[i] = i, i+1
+	}
+
+	stages := []struct {
+		on  bool
+		run func(*rewriter)
+	}{
+		{cfg.confusables, foldConfusables},
+		{cfg.join, joinSplitLetters},
+		{cfg.leet, mapLeet},
+		{cfg.collapse, collapseRepeats},
+	}
+	for _, stage := range stages {
+		if stage.on {
+			stage.run(w)
+			w.next()
+		}
+	}
+	if w.lo == nil {
+		w.lo, w.hi = []int{}, []int{} // the text is deobfuscated even if nothing is left of it
+	}
+	return deobfuscation{s: w.src, lo: w.lo, hi: w.hi}
+}
+
+// confusables are characters that look like ASCII letters, other than those mapped by foldRune.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 't',
+	'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T',
+	'У': 'Y', 'Х': 'X', 'І': 'I', 'Ј': 'J', 'Ѕ': 'S',
+	// Greek
+	'α': 'a', 'ο': 'o', 'ρ': 'p', 'ν': 'v', 'ι': 'i', 'κ': 'k', 'υ': 'u', 'ε': 'e',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O',
+	'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// Latin
+	'ı': 'i', 'ɡ': 'g', 'ß': 's',
+}
+
+// latin1 maps the letters with diacritics of Latin-1, from U+00C0, to ASCII. Characters that are not such
+// letters map to 0.
+const latin1 = "AAAAAAACEEEEIIII\x00NOOOOO\x00OUUUUY\x00\x00aaaaaaaceeeeiiii\x00nooooo\x00ouuuuy\x00y"
+
+// foldRune returns the ASCII character that r looks like, or 0 if there is none.
+func foldRune(r rune) rune {
+	switch {
+	case r >= 0xC0 && r <= 0xFF && latin1[r-0xC0] != 0:
+		return rune(latin1[r-0xC0])
+	case r >= 0xFF01 && r <= 0xFF5E: // fullwidth forms
+		return r - 0xFF01 + '!'
+	case r >= 0x1D400 && r <= 0x1D6A3: // mathematical letters, in styles of 52 letters each
+		i := (r - 0x1D400) % 52
+		if i < 26 {
+			return 'A' + i
+		}
+		return 'a' + i - 26
+	case r >= 0x1D7CE && r <= 0x1D7FF: // mathematical digits, in styles of 10 digits each
+		return '0' + (r-0x1D7CE)%10
+	}
+	return confusables[r]
+}
+
+// isInvisible returns whether r is a combining diacritical mark or a zero-width character,
+// which are removed by FoldConfusables.
+func isInvisible(r rune) bool {
+	switch r {
+	case '\u00ad', '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+		return true
+	}
+	return r >= 0x300 && r <= 0x36F
+}
+
+// foldWord folds a word of an expression like FoldConfusables folds a text.
+func foldWord(s string) string {
+	return strings.Map(func(r rune) rune {
+		if isInvisible(r) {
+			return -1
+		}
+		if a := foldRune(r); a != 0 {
+			return a
+		}
+		return r
+	}, s)
+}
+
+func foldConfusables(w *rewriter) {
+	for i, r := range w.src {
+		size := utf8.RuneLen(r)
+		if r == utf8.RuneError {
+			continue // invalid UTF-8 is kept as it is
+		}
+		if isInvisible(r) {
+			w.copy(w.copied, i)
+			w.replace(i, i+size, "")
+		} else if a := foldRune(r); a != 0 {
+			w.copy(w.copied, i)
+			w.replace(i, i+size, string(a))
+		}
+	}
+}
+
+func joinSplitLetters(w *rewriter) {
+	// single returns whether a word is a single character, and whether it is a letter
+	single := func(tok textToken) (bool, bool) {
+		r, size := utf8.DecodeRuneInString(tok.str)
+		return size == len(tok.str), unicode.IsLetter(r)
+	}
+
+	toks := wordFields(w.src)
+	for i := 0; i < len(toks); {
+		ok, letter := single(toks[i])
+		j := i + 1
+		for ok && j < len(toks) {
+			// the characters must only be separated by punctuation
+			if gap := w.src[toks[j-1].end:toks[j].start]; strings.IndexFunc(gap, unicode.IsSpace) >= 0 {
+				break
+			}
+			next, l := single(toks[j])
+			if !next {
+				break
+			}
+			letter = letter || l
+			j++
+		}
+
+		if ok && letter && j-i >= 3 {
+			for k := i; k < j-1; k++ {
+				w.copy(w.copied, toks[k].end)
+				w.replace(toks[k].end, toks[k+1].start, "")
+			}
+		}
+		i = j
+	}
+}
+
+// leet maps characters substituted for letters in leetspeak to the letters.
+var leet = map[byte]byte{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '@': 'a', '$': 's',
+}
+
+func mapLeet(w *rewriter) {
+	for i := 0; i < len(w.src); {
+		// find the next word, including the symbols that may stand for letters
+		r, size := utf8.DecodeRuneInString(w.src[i:])
+		if !isAlphaNum(r) && leet[w.src[i]] == 0 {
+			i += size
+			continue
+		}
+		var (
+			j      = i
+			letter bool // the word has a letter
+			mapped bool // a digit or symbol to map has been seen
+			mixed  bool // the word has a letter after a digit to map, or a symbol, so it is likely leetspeak
+		)
+		for j < len(w.src) {
+			r, size := utf8.DecodeRuneInString(w.src[j:])
+			if !isAlphaNum(r) && leet[w.src[j]] == 0 {
+				break
+			}
+			switch {
+			case unicode.IsLetter(r):
+				letter = true
+				mixed = mixed || mapped
+			case leet[w.src[j]] != 0:
+				mapped = true
+				mixed = mixed || !isAlphaNum(r)
+			}
+			j += size
+		}
+		if letter && mixed {
+			for k := i; k < j; k++ {
+				if c := leet[w.src[k]]; c != 0 {
+					w.copy(w.copied, k)
+					w.replace(k, k+1, string(c))
+				}
+			}
+		}
+		i = j
+	}
+}
+
+func collapseRepeats(w *rewriter) {
+	var (
+		prev  rune
+		start int // offset of the first repetition of prev
+		count int
+	)
+	for i, r := range w.src + "\x00" {
+		if r == prev && unicode.IsLetter(r) {
+			count++
+			continue
+		}
+		if count >= 3 {
+			// the repetitions are replaced by one, which spans all of them
+			w.copy(w.copied, start)
+			w.replace(start, i, string(prev))
+		}
+		prev, start, count = r, i, 1
+	}
+}
@@ -0,0 +1,136 @@
+package rematch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeobfuscate(t *testing.T) {
+	all := []TextOption{FoldConfusables(), JoinSplitLetters(), MapLeet(), CollapseRepeats()}
+
+	entries := []struct {
+		text    string
+		opts    []TextOption
+		expr    string
+		strs    []string // matched strings, as written in text; nil if the expression should not match
+		matched string   // the deobfuscated text
+	}{
+		{text: "I h4te it", opts: []TextOption{MapLeet()}, expr: "hate", strs: []string{"h4te"}, matched: "I hate it"},
+		{text: "$h@m3 on you", opts: []TextOption{MapLeet()}, expr: "shame+you", strs: []string{"$h@m3", "you"}, matched: "shame on you"},
+		{text: "in 2024, 1 or 3", opts: []TextOption{MapLeet()}, expr: "ioe", matched: "in 2024, 1 or 3"},
+		{text: "my mp3 player, h3ll0", opts: []TextOption{MapLeet()}, expr: "mp3+hello", strs: []string{"mp3", "h3ll0"}, matched: "my mp3 player, hello"},
+		{text: "ipv4 and h264", opts: []TextOption{MapLeet()}, expr: "ipv4+h264", strs: []string{"ipv4", "h264"}, matched: "ipv4 and h264"},
+		{text: "I h.a.t.e it", opts: []TextOption{JoinSplitLetters()}, expr: "hate", strs: []string{"h.a.t.e"}, matched: "I hate it"},
+		{text: "U-S-A and u.s", opts: []TextOption{JoinSplitLetters()}, expr: "USA", strs: []string{"U-S-A"}, matched: "USA and u.s"},
+		{text: "h a t e or v1.2.3", opts: []TextOption{JoinSplitLetters()}, expr: "hate", matched: "h a t e or v1.2.3"},
+		{text: "a.b.c.dog", opts: []TextOption{JoinSplitLetters()}, expr: "abc+dog", strs: []string{"a.b.c", "dog"}, matched: "abc.dog"},
+		{text: "I haaaate it, good", opts: []TextOption{CollapseRepeats()}, expr: "hate+good", strs: []string{"haaaate", "good"}, matched: "I hate it, good"},
+		{text: "heyyyy", opts: []TextOption{CollapseRepeats()}, expr: "hey", strs: []string{"heyyyy"}, matched: "hey"},
+		{text: "I hаtе it", opts: []TextOption{FoldConfusables()}, expr: "hate", strs: []string{"hаtе"}, matched: "I hate it"},
+		{text: "ｈａｔｅ café 𝐡𝐚𝐭𝐞", opts: []TextOption{FoldConfusables()}, expr: "hate+cafe", strs: []string{"ｈａｔｅ", "𝐡𝐚𝐭𝐞", "café"}, matched: "hate cafe hate"},
+		{text: "ha\u200bte cafe\u0301", opts: []TextOption{FoldConfusables()}, expr: "hate+cafe", strs: []string{"ha\u200bte", "cafe\u0301"}, matched: "hate cafe"},
+		{text: "un café noir", opts: []TextOption{FoldConfusables()}, expr: `café+"café noir"`, strs: []string{"café", "café noir"}, matched: "un cafe noir"},
+		{text: "привет мир", opts: []TextOption{FoldConfusables()}, expr: `^ПРИВЕТ~1+"привет мир"`, strs: []string{"привет", "привет мир"}, matched: "пpиbet mиp"},
+		{
+			text:    "You H.4.7.E me, I h44444te you, Ηаtе!",
+			opts:    all,
+			expr:    "^hate+you",
+			strs:    []string{"H.4.7.E", "h44444te", "Ηаtе", "you"},
+			matched: "You HatE me, I hate you, Hate!",
+		},
+		{text: "I h4te it", opts: all, expr: `^"i hate"+h?te`, strs: []string{"I h4te", "h4te"}, matched: "I hate it"},
+		{text: "I h4te it", expr: "hate", matched: "I h4te it"},
+		{text: "I h4ate it", opts: []TextOption{MapLeet()}, expr: "hate~1", strs: []string{"h4ate"}, matched: "I haate it"},
+	}
+
+	for i, entry := range entries {
+		text := NewText(entry.text, entry.opts...)
+		if text.Raw() != entry.text {
+			t.Errorf("test #%d should have raw=%q, but raw=%q", i+1, entry.text, text.Raw())
+		}
+		if text.raw != entry.matched {
+			t.Errorf("test #%d should have matched %q, but matched %q", i+1, entry.matched, text.raw)
+		}
+
+		res, err := FindAll(NewExpr(entry.expr), text)
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if res.Match != (entry.strs != nil) || (res.Match && !reflect.DeepEqual(res.Strings, entry.strs)) {
+			t.Errorf("test #%d should have strs=%q, but res=%+v", i+1, entry.strs, res)
+			continue
+		}
+		for _, span := range res.Spans {
+			if s := text.Raw()[span.Start:span.End]; !testContains(entry.strs, s) && span.Kind != SpanPhrase {
+				t.Errorf("test #%d should have spans of %q, but span=%+v (%q)", i+1, entry.strs, span, s)
+			}
+		}
+	}
+}
+
+func TestFoldConfusablesRuleSet(t *testing.T) {
+	// words of an expression are folded like the text, including the words a RuleSet indexes
+	rs := NewRuleSet()
+	if err := rs.Add("moscow", NewExpr("Москва")); err != nil {
+		t.Fatal(err)
+	}
+	for i, text := range []string{"из Москвы в Москва", "Москва"} {
+		if ids, err := rs.Match(NewText(text, FoldConfusables())); err != nil || !reflect.DeepEqual(ids, []string{"moscow"}) {
+			t.Errorf("test #%d should have matched [moscow], but matched %v, err=%v", i+1, ids, err)
+		}
+	}
+}
+
+func testContains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeobfuscateReader(t *testing.T) {
+	text := strings.Repeat("the cow jumped over the moon. ", 10) + "I h.4.t.e the m00n! " + strings.Repeat("The dish ran away. ", 10)
+	opts := []TextOption{JoinSplitLetters(), MapLeet(), CollapseRepeats()}
+
+	for i, raw := range []string{"hate+moon", `"hate the moon"`, "hate~2~moon+!spoon"} {
+		expr := NewExpr(raw)
+		expected, _ := FindAll(expr, NewText(text, opts...))
+		if !expected.Match {
+			t.Fatalf("test #%d should have matched", i+1)
+		}
+		for _, window := range []int{5, 16, 1000} {
+			res, err := FindAllReader(expr, strings.NewReader(text), append(opts, StreamWindow(window))...)
+			if err != nil || !reflect.DeepEqual(res, expected) {
+				t.Errorf("test #%d (window=%d) should have res=%+v, but res=%+v, err=%v", i+1, window, expected, res, err)
+			}
+		}
+	}
+
+	// the first chunk of the default window ends within an obfuscated word, which must not be split
+	pad := strings.Repeat("x", 65530)
+	entries := []struct {
+		text string
+		opt  TextOption
+	}{
+		{text: pad + " h.a.t.e z", opt: JoinSplitLetters()},
+		{text: pad + " h\u200bate z", opt: FoldConfusables()},
+	}
+	for i, entry := range entries {
+		for _, raw := range []string{"h", "a", "hate"} {
+			expr := NewExpr(raw)
+			expected, _ := FindAll(expr, NewText(entry.text, entry.opt))
+			res, err := FindAllReader(expr, strings.NewReader(entry.text), entry.opt)
+			if err != nil || !reflect.DeepEqual(res, expected) {
+				t.Errorf("test #%d (%s) should have res=%+v, but res=%+v, err=%v", i+1, raw, expected, res, err)
+			}
+			ok, err := EvalReader(expr, strings.NewReader(entry.text), entry.opt)
+			if err != nil || ok != expected.Match {
+				t.Errorf("test #%d (%s) should have ok=%v, but ok=%v, err=%v", i+1, raw, expected.Match, ok, err)
+			}
+		}
+	}
+}
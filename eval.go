@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/pixeltopic/rematch/internal/stack"
 )
@@ -19,6 +23,9 @@ const (
 	opWildcardQstn = '?'
 	opNot          = '!'
 	opWildcardSpce = '_'
+	opPhrase       = '"'
+	opNear         = '~'
+	opFold         = '^'
 )
 
 // SyntaxError occurs when an expression is malformed.
@@ -28,6 +35,73 @@ func (e SyntaxError) Error() string {
 	return fmt.Sprintf("SyntaxError:%s", string(e))
 }
 
+// expectations reported by a ParseError
+const (
+	wantOperand  = "word, phrase, pattern, '!' or '('"
+	wantOperator = "'+', '|', '~n~' or ')'"
+)
+
+// ParseError describes where and why an expression is malformed.
+//
+// It wraps a SyntaxError, so errors.Is can be used to check for a specific problem.
+type ParseError struct {
+	Expr     string      // raw expression as it was tokenized (after normalization, if any)
+	Offset   int         // byte offset of the problem in Expr
+	Token    string      // offending token or character; empty if the problem is at the end of the expression
+	Expected string      // description of what was expected at Offset, if known
+	Err      SyntaxError // the problem
+}
+
+// newParseError returns a ParseError for the problem at offset, caused by tok.
+func newParseError(err SyntaxError, offset int, tok, expected string) *ParseError {
+	return &ParseError{Offset: offset, Token: tok, Expected: expected, Err: err}
+}
+
+// report returns err to stop parsing, unless errs is not nil, in which case err is collected
+// and nil is returned so the caller can recover from the problem and look for more.
+func report(errs *[]error, err *ParseError) error {
+	if errs == nil {
+		return err
+	}
+	*errs = append(*errs, err)
+	return nil
+}
+
+func (e *ParseError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s at offset %d", e.Err.Error(), e.Offset)
+	}
+	return fmt.Sprintf("%s at offset %d (%q)", e.Err.Error(), e.Offset, e.Token)
+}
+
+// Unwrap returns the underlying SyntaxError.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Caret renders the expression with a caret under the problem, followed by a description of it. For example:
+//
+//	cow++moon
+//	    ^ unexpected infix operator, want operand; expected word, phrase, pattern, '!' or '('
+func (e *ParseError) Caret() string {
+	offset := e.Offset
+	if offset > len(e.Expr) {
+		offset = len(e.Expr)
+	}
+
+	var b strings.Builder
+	b.WriteString(e.Expr)
+	b.WriteByte('\n')
+	b.WriteString(strings.Repeat(" ", utf8.RuneCountInString(e.Expr[:offset])))
+	b.WriteString("^ ")
+	b.WriteString(string(e.Err))
+	if e.Expected != "" {
+		b.WriteString("; expected ")
+		b.WriteString(e.Expected)
+	}
+	return b.String()
+}
+
 // EvalError occurs when an expression fails to evaluate because it is in improper RPN
 type EvalError string
 
@@ -38,11 +112,15 @@ func (e EvalError) Error() string {
 type (
 	// token represents a piece of the output produced by the Shunting-yard algorithm.
 	// It contains the token itself (which may be a word, pattern, or operator)
-	// and if it is a word or pattern, whether it will be negated when building subresults.
+	// and if it is a word or pattern, whether it is negated (below an odd number of NOT operators).
 	token struct {
 		Str    string `json:"s"`
-		Negate bool   `json:"-"` // negate match result in the subresult during RPN step
+		Negate bool   `json:"-"` // derived from the tree of the expression; not used for evaluation
 		Regex  bool   `json:"-"`
+		Phrase bool   `json:"-"` // Str is a quoted sequence of words that must appear consecutively
+
+		re       *regexp.Regexp // precompiled pattern of a regex token; may be nil if it was never compiled
+		pos, end int            // byte offsets of the token in the raw expression; not included in JSON
 	}
 
 	// tokenJSON is an auxiliary type for marshalling into a more compact JSON string
@@ -50,12 +128,56 @@ type (
 		*tokenAlias
 		Negate int `json:"!,omitempty"`
 		Regex  int `json:"r,omitempty"`
+		Phrase int `json:"p,omitempty"`
 	}
 
 	// tokenAlias is an auxiliary type for aliasing (removing the custom token unmarshal receiver so stack will not overflow)
 	tokenAlias token
 )
 
+// folded returns whether a word, phrase or pattern token is matched case-insensitively.
+func (t token) folded() bool {
+	return len(t.Str) > 0 && t.Str[0] == opFold
+}
+
+// term returns the word, phrase or pattern of a token without its case or fuzzy modifiers.
+func (t token) term() string {
+	s := t.Str
+	if i := fuzzyOffset(t); i >= 0 {
+		s = s[:i]
+	}
+	if t.folded() {
+		s = s[1:]
+	}
+	return s
+}
+
+// edits returns the maximum edit distance of a fuzzy word token, such as 1 for colour~1. It is 0 for any other token.
+func (t token) edits() int {
+	i := fuzzyOffset(t)
+	if i < 0 {
+		return 0
+	}
+	n, _ := strconv.Atoi(t.Str[i+1:])
+	return n
+}
+
+// fuzzyOffset returns the offset of the fuzzy modifier of a word token, or -1 if it does not have one.
+func fuzzyOffset(t token) int {
+	if t.Regex || t.Phrase || isNearOp(t.Str) {
+		return -1
+	}
+	return strings.LastIndexByte(t.Str, opNear)
+}
+
+// fuzzySuffix returns the fuzzy modifier of a word matched within n edits, such as ~1. It is empty if n is 0.
+func fuzzySuffix(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return string(opNear) + strconv.Itoa(n)
+}
+
 // MarshalJSON implements JSON marshalling
 func (t token) MarshalJSON() ([]byte, error) {
 
@@ -71,6 +193,10 @@ func (t token) MarshalJSON() ([]byte, error) {
 		tokJSON.Regex = 1
 	}
 
+	if t.Phrase {
+		tokJSON.Phrase = 1
+	}
+
 	return json.Marshal(tokJSON)
 }
 
@@ -86,43 +212,133 @@ func (t *token) UnmarshalJSON(data []byte) error {
 
 	t.Negate = aux.Negate != 0
 	t.Regex = aux.Regex != 0
+	t.Phrase = aux.Phrase != 0
+
+	return t.compile()
+}
 
+// compile precompiles the pattern of a regex token. It is a no-op for any other token.
+func (t *token) compile() error {
+	if !t.Regex {
+		return nil
+	}
+	re, err := regexp.Compile(replaceIfRegex(*t))
+	if err != nil {
+		return SyntaxError("invalid pattern")
+	}
+	t.re = re
 	return nil
 }
 
-// subresult is an intermediary struct for tracking whether a collection of matching strings should be returned
-// at the end of evalRPN's execution
-type subresult struct {
-	Strings []string
-	OK      bool // the contents of subresult.Strings should be concatenated to Result.strings at the end of evaluation if this is true and Result.Match is true
+// pattern returns the compiled pattern of a regex token, compiling it if it was not precompiled.
+func (t token) pattern() *regexp.Regexp {
+	if t.re != nil {
+		return t.re
+	}
+	return regexp.MustCompile(replaceIfRegex(t))
 }
 
 // Result is the output after evaluating a query.
 //
 // Strings contains a non-unique/non-ordered collection of token matches from the given expression.
+// Only words, phrases and patterns that matched and are not negated contribute, where an operand is negated
+// if it is below an odd number of NOT operators; for example, "cow" contributes to both "cow" and "!!cow",
+// but not to "!(cow+moon)". An operand that occurs more than once in the expression contributes once per occurrence.
+//
+// Spans locates every occurrence of those matches in the text, ordered by position.
 type Result struct {
 	Match   bool
 	Strings []string
+	Spans   []Span
 }
 
+// SpanKind identifies the type of expression token that produced a Span.
+type SpanKind int
+
+// span kinds
+const (
+	SpanWord SpanKind = iota
+	SpanPhrase
+	SpanPattern
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanWord:
+		return "word"
+	case SpanPhrase:
+		return "phrase"
+	case SpanPattern:
+		return "pattern"
+	}
+	return fmt.Sprintf("SpanKind(%d)", int(k))
+}
+
+// MarshalText implements encoding.TextMarshaler, so a SpanKind is encoded in JSON as "word", "phrase" or "pattern".
+func (k SpanKind) MarshalText() ([]byte, error) {
+	switch k {
+	case SpanWord, SpanPhrase, SpanPattern:
+		return []byte(k.String()), nil
+	}
+	return nil, fmt.Errorf("rematch: invalid span kind %d", int(k))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *SpanKind) UnmarshalText(text []byte) error {
+	for _, kind := range []SpanKind{SpanWord, SpanPhrase, SpanPattern} {
+		if string(text) == kind.String() {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("rematch: invalid span kind %q", text)
+}
+
+// Span is the location of a match in the raw string of a Text.
+//
+// Start and End are byte offsets, so the matched substring is raw[Start:End].
+// Token is the expression token (as found in Expr.RPN) that produced the match.
+type Span struct {
+	Start int
+	End   int
+	Token string
+	Kind  SpanKind
+}
+
+// allowedWordChars returns whether a rune may be part of a word in an expression.
+// This must agree with the characters kept by replaceNonAlphaNum when tokenizing text.
+// With a Tokenizer given to TokenizeExpr, words may contain other characters, but must be words to the tokenizer.
 func allowedWordChars(c rune) bool {
-	return ('a' <= c && c <= 'z') ||
-		('A' <= c && c <= 'Z') ||
-		('0' <= c && c <= '9')
+	return isAlphaNum(c)
 }
 
 // tokenizeExpr converts the expression into a string slice of tokens.
 // performs validation on a "word" type token to ensure it does not contain non-alphanumeric characters
-// or only consists of wildcards
+// or only consists of wildcards.
+// Errors are returned as a *ParseError locating the problem in the expression.
 func tokenizeExpr(expr string) ([]token, error) {
+	return scanExpr(expr, nil, nil)
+}
+
+// scanExpr implements tokenizeExpr. If errs is not nil, every problem is collected in errs rather than returned,
+// and tokenization continues as if it had been corrected so that later problems are found too.
+// Tokens produced while recovering are only suitable for finding more problems, not for evaluation.
+// If words is not nil, words and the words of phrases may contain any character other than whitespace and operators,
+// but each must be a single word to words.
+func scanExpr(expr string, words Tokenizer, errs *[]error) ([]token, error) {
 	var (
-		tokens []token
-		word   strings.Builder
-		adjAst bool //adjacent to asterisk wildcard
-		adjWs  bool // adjacent to whitespace wildcard
+		tokens    []token
+		word      strings.Builder
+		wordStart int  // offset of the word (or its case modifier) being built
+		adjAst    bool //adjacent to asterisk wildcard
+		adjWs     bool // adjacent to whitespace wildcard
+		fold      bool // the next word, phrase or pattern is case-insensitive
+		other     bool // the word being built has a character that is not alphanumeric, allowed by words
 	)
 
-	flushWordTok := func() error {
+	errFold := SyntaxError("unexpected case modifier; must precede a word, phrase or pattern")
+
+	flushWordTok := func(end int) error {
 		if word.Len() != 0 { // no op if word is of length 0, since we flush at the end of tokenization as safety
 
 			tokStr := word.String()
@@ -144,7 +360,11 @@ func tokenizeExpr(expr string) ([]token, error) {
 			}
 
 			if !valid {
-				return SyntaxError("invalid word; cannot only contain wildcards")
+				// when recovering, the word is kept so it is still treated as an operand
+				if err := report(errs, newParseError(SyntaxError("invalid word; cannot only contain wildcards"), wordStart, expr[wordStart:end], "a letter or digit")); err != nil {
+					return err
+				}
+				isRegex = true
 			}
 
 			// only do a check if isRegex is not already true in case the WildcardCheck loop terminates early
@@ -155,7 +375,25 @@ func tokenizeExpr(expr string) ([]token, error) {
 				isRegex = true
 			}
 
-			tokens = append(tokens, token{Str: tokStr, Regex: isRegex})
+			switch {
+			case isRegex && other:
+				// patterns are matched against the raw text rather than words, so they are not affected by the tokenizer
+				if err := report(errs, newParseError(SyntaxError("invalid char in pattern; must be alphanumeric or a wildcard"), wordStart, expr[wordStart:end], "a letter, digit or wildcard")); err != nil {
+					return err
+				}
+			case !isRegex && words != nil && !isWord(words, tokStr):
+				if err := report(errs, newParseError(errNotWord, wordStart, expr[wordStart:end], "a single word")); err != nil {
+					return err
+				}
+			}
+			other = false
+
+			if fold {
+				tokStr = string(opFold) + tokStr
+				fold = false
+			}
+
+			tokens = append(tokens, token{Str: tokStr, Regex: isRegex, pos: wordStart, end: end})
 			word.Reset()
 
 		}
@@ -163,6 +401,13 @@ func tokenizeExpr(expr string) ([]token, error) {
 		return nil
 	}
 
+	// startWord records the offset of a new word unless a word or case modifier was already started
+	startWord := func(i int) {
+		if word.Len() == 0 && !fold {
+			wordStart = i
+		}
+	}
+
 	for i := 0; i < len(expr); i++ {
 		switch char := rune(expr[i]); char {
 		case opGroupL:
@@ -174,88 +419,320 @@ func tokenizeExpr(expr string) ([]token, error) {
 		case opAnd:
 			fallthrough
 		case opOr:
-			if err := flushWordTok(); err != nil {
+			if err := flushWordTok(i); err != nil {
 				return nil, err
 			}
-			tokens = append(tokens, token{Str: string(char)})
+			if fold {
+				if err := report(errs, newParseError(errFold, i, string(char), "word, phrase or pattern")); err != nil {
+					return nil, err
+				}
+				fold = false
+			}
+			tokens = append(tokens, token{Str: string(char), pos: i, end: i + 1})
 			adjAst, adjWs = false, false
+		case opNear:
+			afterWord := word.Len() != 0
+			if err := flushWordTok(i); err != nil {
+				return nil, err
+			}
+			if fold {
+				if err := report(errs, newParseError(errFold, i, string(char), "word, phrase or pattern")); err != nil {
+					return nil, err
+				}
+				fold = false
+			}
+			if n, end, ok := fuzzyModifier(expr, i); ok {
+				// when recovering, a misplaced modifier is ignored
+				if last := len(tokens) - 1; !afterWord || tokens[last].Regex {
+					if err := report(errs, newParseError(SyntaxError("invalid fuzzy operand; must be a word"), i, expr[i:end], "a word before '~n'")); err != nil {
+						return nil, err
+					}
+				} else {
+					tokens[last].Str += fuzzySuffix(n)
+					tokens[last].end = end
+				}
+				i = end - 1
+				adjAst, adjWs = false, false
+				continue
+			}
+			errNear := SyntaxError("invalid proximity operator; want ~n~")
+			end := strings.IndexByte(expr[i+1:], opNear)
+			if end < 0 {
+				// when recovering, the lone ~ is treated as a proximity operator
+				if err := report(errs, newParseError(errNear, i, expr[i:], "'~n~' where n is a number of words")); err != nil {
+					return nil, err
+				}
+				tok := nearTok(0)
+				tok.pos, tok.end = i, i+1
+				tokens = append(tokens, tok)
+				adjAst, adjWs = false, false
+				continue
+			}
+			n, err := strconv.Atoi(expr[i+1 : i+1+end])
+			if err != nil || n < 0 || strings.ContainsAny(expr[i+1:i+1+end], "+-") {
+				if err := report(errs, newParseError(errNear, i, expr[i:i+end+2], "'~n~' where n is a number of words")); err != nil {
+					return nil, err
+				}
+				n = 0
+			}
+			tok := nearTok(n)
+			tok.pos, tok.end = i, i+end+2
+			tokens = append(tokens, tok)
+			i += end + 1
+			adjAst, adjWs = false, false
+		case opPhrase:
+			if err := flushWordTok(i); err != nil {
+				return nil, err
+			}
+			startWord(i)
+			end := strings.IndexByte(expr[i+1:], opPhrase)
+			if end < 0 {
+				// when recovering, the phrase is closed at the end of the expression
+				if err := report(errs, newParseError(SyntaxError("unterminated phrase"), i, expr[i:], `closing '"'`)); err != nil {
+					return nil, err
+				}
+				end = len(expr) - i - 1
+			}
+			tok, err := phraseTok(expr[i+1:i+1+end], i+1, words, errs)
+			if err != nil {
+				return nil, err
+			}
+			if fold {
+				tok.Str = string(opFold) + tok.Str
+				fold = false
+			}
+			tok.pos, tok.end = wordStart, i+end+2
+			if tok.end > len(expr) {
+				tok.end = len(expr) // unterminated
+			}
+			tokens = append(tokens, tok)
+			i += end + 1
+			adjAst, adjWs = false, false
+		case opFold:
+			if word.Len() != 0 || fold {
+				// when recovering, the modifier is ignored
+				if err := report(errs, newParseError(errFold, i, string(char), "")); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			wordStart = i
+			fold = true
 		case opWildcardAst:
+			startWord(i)
 			if !adjAst {
 				word.WriteRune(char)
 				adjAst = true
 			}
 			adjWs = false
 		case opWildcardQstn:
+			startWord(i)
 			word.WriteRune(char)
 			adjAst, adjWs = false, false
 		case opWildcardSpce:
+			startWord(i)
 			if !adjWs {
 				word.WriteRune(char)
 				adjWs = true
 			}
 			adjAst = false
 		default:
-			if !allowedWordChars(char) {
-				return nil, SyntaxError("invalid char in word; must be alphanumeric")
+			// operators are all ASCII, so a multi-byte character can only be part of a word
+			char, size := utf8.DecodeRuneInString(expr[i:])
+			if words != nil && char != utf8.RuneError && !allowedWordChars(char) && !unicode.IsSpace(char) {
+				other = true // checked once the word is complete
+			} else if char == utf8.RuneError || !allowedWordChars(char) {
+				// when recovering, the character is skipped
+				if err := report(errs, newParseError(SyntaxError("invalid char in word; must be alphanumeric"), i, expr[i:i+size], "a letter, digit, wildcard or operator")); err != nil {
+					return nil, err
+				}
+				i += size - 1
+				continue
 			}
+			startWord(i)
 			word.WriteRune(char)
+			i += size - 1
 			adjAst, adjWs = false, false
 		}
 	}
-	if err := flushWordTok(); err != nil {
+	if err := flushWordTok(len(expr)); err != nil {
 		return nil, err
 	}
+	if fold {
+		if err := report(errs, newParseError(errFold, len(expr), "", "word, phrase or pattern")); err != nil {
+			return nil, err
+		}
+	}
 
 	return tokens, nil
 }
 
-// negateToks tracks whether a word or pattern starting from min should be negated in the find output.
-// parens are not accounted for because they are not included in RPN form.
-// nor are any of the wildcard operator variants handled because they exist as part of patterns.
-func negateToks(min int, rpnTokens []token) {
+// errFuzzyNear is the problem with a fuzzy word as an operand of a proximity operator.
+const errFuzzyNear = SyntaxError("invalid proximity operand; cannot be a fuzzy word")
 
-	// rpnTokens may or may not be completely constructed when this func is run.
-	// it negates a slice of rpnTokens from [min:len(rpnTokens)],
-	// but rpnTokens can have non-negated tokens appended later on in the algorithm execution
-	for i := min; i < len(rpnTokens); i++ {
-		switch rpnTokens[i].Str {
-		case string(opNot):
-		case string(opAnd):
-		case string(opOr):
-		default:
-			rpnTokens[i].Negate = !rpnTokens[i].Negate
+// fuzzyModifier returns the edit distance and end offset of a fuzzy modifier at expr[i], which is a '~' followed by
+// a number that is not followed by another '~', as in colour~1. ok is false if there is none, such as for ~2~.
+func fuzzyModifier(expr string, i int) (n, end int, ok bool) {
+	end = i + 1
+	for end < len(expr) && expr[end] >= '0' && expr[end] <= '9' {
+		end++
+	}
+	// the number must be followed by the end of the expression or by an operator that may follow an operand
+	ends := string(opAnd) + string(opOr) + string(opGroupL) + string(opGroupR) + string(opNot) + string(opPhrase) + string(opFold)
+	if end == i+1 || (end < len(expr) && strings.IndexByte(ends, expr[end]) < 0) {
+		return 0, 0, false
+	}
+	n, err := strconv.Atoi(expr[i+1 : end])
+	return n, end, err == nil
+}
+
+// phraseTok validates the contents of a quoted phrase and returns it as a phrase token.
+// Words in a phrase follow the same rules as plain words, but wildcards are not permitted.
+// Whitespace between words is collapsed so equivalent phrases produce the same token.
+// offset is the position of s in the raw expression, used to locate errors.
+// If errs is not nil, problems are collected as they are in scanExpr.
+// If tokenizer is not nil, each word of the phrase must be a single word to it, as in scanExpr.
+func phraseTok(s string, offset int, tokenizer Tokenizer, errs *[]error) (token, error) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if err := report(errs, newParseError(SyntaxError("invalid phrase; must contain at least one word"), offset-1, `"`+s+`"`, "a word")); err != nil {
+			return token{}, err
 		}
 	}
+	if tokenizer != nil {
+		for i := 0; i < len(s); {
+			end := strings.IndexFunc(s[i:], unicode.IsSpace)
+			if end < 0 {
+				end = len(s) - i
+			}
+			if w := s[i : i+end]; w != "" && !isWord(tokenizer, w) {
+				if err := report(errs, newParseError(errNotWord, offset+i, w, "a single word")); err != nil {
+					return token{}, err
+				}
+			}
+			_, size := utf8.DecodeRuneInString(s[i+end:])
+			i += end + size
+		}
+	} else {
+		for i, c := range s {
+			if !allowedWordChars(c) && !unicode.IsSpace(c) {
+				if err := report(errs, newParseError(SyntaxError("invalid char in phrase; must be alphanumeric"), offset+i, string(c), "a letter, digit or whitespace")); err != nil {
+					return token{}, err
+				}
+			}
+		}
+	}
+	return token{Str: string(opPhrase) + strings.Join(words, " ") + string(opPhrase), Phrase: true}, nil
+}
+
+// phraseWords returns the words of a phrase token in order.
+func phraseWords(tok token) []string {
+	return strings.Fields(strings.Trim(tok.term(), string(opPhrase)))
+}
+
+// nearTok returns a proximity operator token for a maximum distance of n word positions.
+func nearTok(n int) token {
+	return token{Str: string(opNear) + strconv.Itoa(n) + string(opNear)}
+}
+
+// isNearOp returns whether a token string is a proximity operator such as ~5~.
+func isNearOp(s string) bool {
+	return len(s) > 2 && s[0] == opNear && s[len(s)-1] == opNear
+}
+
+// nearDistance returns the maximum distance of a proximity operator token.
+func nearDistance(s string) int {
+	n, _ := strconv.Atoi(s[1 : len(s)-1])
+	return n
 }
 
 // shuntingYard is an implementation of the Shunting-yard algorithm.
-// Produces a string slice ordered in Reverse Polish notation;
-// will err if unbalanced parenthesis or invalid expression syntax
+// Produces a string slice ordered in Reverse Polish notation, derived from the tree built by shunt;
+// will err if unbalanced parenthesis or invalid expression syntax.
+// Errors are returned as a *ParseError locating the offending token.
 func shuntingYard(tokens []token) ([]token, error) {
+	root, err := shunt(tokens, nil)
+	if err != nil {
+		return nil, err
+	}
+	return rpnTokens(root), nil
+}
+
+// shunt implements shuntingYard, building the tree of the expression rather than emitting RPN.
+// Every operator popped from the operator stack is applied to the nodes on the output stack.
+//
+// If errs is not nil, every problem is collected in errs rather than returned.
+// Parsing then continues as if a missing operand or operator had been inserted, or an unmatched parenthesis removed,
+// so that later problems are found too. The tree produced while recovering is not suitable for evaluation.
+func shunt(tokens []token, errs *[]error) (Node, error) {
 	const (
 		expectOperator = 0
 		expectOperand  = 1
 	)
 
 	var (
-		rpnTokens []token
-		lookbacks []int
-		// lookbacks is a slice of ints which contain the minimum index to start searching for tokens to negate before the slice is flushed.
-		// Indices are appended when a negation operator is encountered.
-		opStack = stack.New() // stack of strings; stores operators only
+		output  = stack.New() // stack of Nodes; operands and operators applied to them
+		opStack = stack.New() // stack of tokens; stores operators only
 		state   = expectOperand
+
+		// proximity operators bind tighter than any other operator and only accept words or phrases as operands,
+		// so they are never pushed to opStack. The operator is applied as soon as its right operand is output.
+		lastOperand *token // most recent operand if it was the last token seen; nil otherwise
+		pendingNear *token // proximity operator awaiting its right operand
 	)
 
-	identifyNegatedToks := func(op string) {
-		if op == string(opNot) {
-			for _, l := range lookbacks {
-				negateToks(l, rpnTokens)
-			}
-			lookbacks = []int{}
+	// apply replaces the operands of op on the output stack with a node of op.
+	// Operands are only missing while recovering from a problem, in which case they are nil.
+	apply := func(op token) {
+		if op.Str == string(opNot) {
+			n, _ := output.Pop().(Node)
+			output.Push(&NotNode{Node: n})
+			return
+		}
+
+		b, _ := output.Pop().(Node)
+		a, _ := output.Pop().(Node)
+		switch op.Str {
+		case string(opAnd):
+			output.Push(&AndNode{Nodes: []Node{a, b}})
+		case string(opOr):
+			output.Push(&OrNode{Nodes: []Node{a, b}})
+		default:
+			output.Push(&NearNode{Left: a, Right: b, Distance: nearDistance(op.Str)})
 		}
 	}
 
-	for _, tok := range tokens {
+	for i := range tokens {
+		tok := tokens[i]
+
+		if isNearOp(tok.Str) {
+			if state != expectOperator {
+				if err := report(errs, newParseError(SyntaxError("unexpected proximity operator, want operand"), tok.pos, tok.Str, wantOperand)); err != nil {
+					return nil, err
+				}
+			} else if lastOperand == nil || lastOperand.Regex {
+				if err := report(errs, newParseError(SyntaxError("invalid proximity operand; must be a word or phrase"), tok.pos, tok.Str, "word or phrase before '~n~'")); err != nil {
+					return nil, err
+				}
+			}
+			pendingNear = &tokens[i]
+			lastOperand = nil
+			state = expectOperand
+			continue
+		}
+
+		if pendingNear != nil && (tok.Str == string(opNot) || tok.Str == string(opGroupL) || tok.Regex) {
+			if err := report(errs, newParseError(SyntaxError("invalid proximity operand; must be a word or phrase"), tok.pos, tok.Str, "word or phrase")); err != nil {
+				return nil, err
+			}
+			pendingNear = nil
+		} else if pendingNear != nil && tok.edits() > 0 {
+			if err := report(errs, newParseError(errFuzzyNear, tok.pos, tok.Str, "word without '~n' or phrase")); err != nil {
+				return nil, err
+			}
+			pendingNear = nil
+		}
+
 		switch tok.Str {
 		case string(opAnd):
 			// AND and OR infix operators have EQUAL precedence, meaning the expression will be evaluated from left to right during absence of groups.
@@ -268,40 +745,37 @@ func shuntingYard(tokens []token) ([]token, error) {
 				push it onto the operator stack.
 			*/
 			if state != expectOperator {
-				return nil, SyntaxError("unexpected infix operator, want operand")
+				if err := report(errs, newParseError(SyntaxError("unexpected infix operator, want operand"), tok.pos, tok.Str, wantOperand)); err != nil {
+					return nil, err
+				}
 			}
-			for opStack.Len() > 0 && opStack.Peek() != string(opGroupL) {
-				op := opStack.Pop().(string)
-
-				// for every value in lookbacks, negate all word or patterns up to the current length of rpnTokens. Then flush lookbacks.
-				// this will ensure that only words or patterns within the negation scope will be affected.
-				identifyNegatedToks(op)
-
-				rpnTokens = append(rpnTokens, token{Str: op})
+			for opStack.Len() > 0 && opStack.Peek().(token).Str != string(opGroupL) {
+				apply(opStack.Pop().(token))
 			}
-			opStack.Push(tok.Str)
+			opStack.Push(tok)
+			lastOperand = nil
 			state = expectOperand
 		case string(opNot):
 			if state != expectOperand {
-				return nil, SyntaxError("unexpected negation")
-			}
-			opStack.Push(tok.Str)
-			// keep track of the current index this token corresponds to;
-			// len(rpnTokens) will not be index out of range because there will always be at least
-			// one token that will be appended in the rpnTokens before we iterate with this index.
-			// Note that the lookback slice will only be iterated through when ops are popped
-			// and the op is a NOT op
-			lookbacks = append(lookbacks, len(rpnTokens))
+				if err := report(errs, newParseError(SyntaxError("unexpected negation"), tok.pos, tok.Str, wantOperator)); err != nil {
+					return nil, err
+				}
+			}
+			opStack.Push(tok)
 			state = expectOperand
 		case string(opGroupL):
 			if state != expectOperand {
-				return nil, SyntaxError("unexpected left parenthesis")
+				if err := report(errs, newParseError(SyntaxError("unexpected left parenthesis"), tok.pos, tok.Str, wantOperator)); err != nil {
+					return nil, err
+				}
 			}
-			opStack.Push(tok.Str)
+			opStack.Push(tok)
 			state = expectOperand
 		case string(opGroupR):
 			if state != expectOperator {
-				return nil, SyntaxError("unexpected right parenthesis")
+				if err := report(errs, newParseError(SyntaxError("unexpected right parenthesis"), tok.pos, tok.Str, wantOperand)); err != nil {
+					return nil, err
+				}
 			}
 
 			var lParenWasFound bool
@@ -309,7 +783,7 @@ func shuntingYard(tokens []token) ([]token, error) {
 			// while the operator at the top of the operator stack is not a left parenthesis:
 			//   pop the operator from the operator stack onto the output queue.
 			for opStack.Len() > 0 {
-				if opStack.Peek() == string(opGroupL) {
+				if opStack.Peek().(token).Str == string(opGroupL) {
 					lParenWasFound = true
 
 					// if there is a left parenthesis at the top of the operator stack, then:
@@ -317,148 +791,409 @@ func shuntingYard(tokens []token) ([]token, error) {
 					opStack.Pop()
 					break
 				}
-				op := opStack.Pop().(string)
-
-				// for every value in lookbacks, negate all word or patterns up to the current length of rpnTokens. Then flush lookbacks.
-				// this will ensure that only words or patterns within the negation scope will be affected.
-				identifyNegatedToks(op)
-
-				rpnTokens = append(rpnTokens, token{Str: op})
+				apply(opStack.Pop().(token))
 			}
 			// If the stack runs out without finding a left parenthesis, then there are mismatched parentheses.
 			if !lParenWasFound {
-				return nil, SyntaxError("mismatched parenthesis")
+				if err := report(errs, newParseError(SyntaxError("mismatched parenthesis"), tok.pos, tok.Str, "a preceding '('")); err != nil {
+					return nil, err
+				}
 			}
 
+			lastOperand = nil
+
 			state = expectOperator
 		default:
 			if state != expectOperand {
-				return nil, SyntaxError("unexpected operand, want operator")
+				if err := report(errs, newParseError(SyntaxError("unexpected operand, want operator"), tok.pos, tok.Str, wantOperator)); err != nil {
+					return nil, err
+				}
 			}
 			// the token is not an operator; but a word.
-			rpnTokens = append(rpnTokens, tok)
+			output.Push(tokNode(tok))
+			lastOperand = &tokens[i]
+			if pendingNear != nil {
+				apply(*pendingNear)
+				// a proximity result cannot be the operand of another proximity operator
+				lastOperand, pendingNear = nil, nil
+			}
 			state = expectOperator
 		}
 	}
 
+	// the end of the expression is the end of its last token, since whitespace is not permitted outside of phrases
+	var end int
+	if len(tokens) > 0 {
+		end = tokens[len(tokens)-1].end
+	}
+
 	if state != expectOperator {
-		return nil, SyntaxError("unexpected operator at end of expression, want operand")
+		if err := report(errs, newParseError(SyntaxError("unexpected operator at end of expression, want operand"), end, "", wantOperand)); err != nil {
+			return nil, err
+		}
 	}
 
 	/* After while loop, if operator stack not null, pop everything to output queue */
 	for opStack.Len() > 0 {
-		op := opStack.Pop().(string)
-		switch op {
+		op := opStack.Pop().(token)
+		switch op.Str {
 		case string(opGroupL):
 			fallthrough
 		case string(opGroupR):
-			return nil, SyntaxError("mismatched parenthesis at end of expression")
-		case string(opNot):
-			// for every value in lookbacks, negate all word or patterns up to the current length of rpnTokens. Then flush lookbacks.
-			// this will ensure that only words or patterns within the negation scope will be affected.
-			identifyNegatedToks(op)
+			if err := report(errs, newParseError(SyntaxError("mismatched parenthesis at end of expression"), op.pos, op.Str, "a matching ')'")); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
-		rpnTokens = append(rpnTokens, token{Str: op})
+		apply(op)
 	}
 
-	return rpnTokens, nil
+	root, _ := output.Pop().(Node)
+	return root, nil
 }
 
 // evalRPN evaluates a slice of string tokens in Reverse Polish notation into a boolean result.
-func evalRPN(rpnTokens []token, text *Text) (res *Result, err error) {
-	argStack := stack.New()              // stack of bools
-	auxResult := map[string]*subresult{} // mapping of word or pattern keys to results.
+// The tokens are converted into a tree first; an EvalError is returned if they are not in proper RPN.
+func evalRPN(rpnTokens []token, text *Text) (*Result, error) {
+	root, err := rpnToNode(rpnTokens)
+	if err != nil {
+		return nil, err
+	}
+	return evalNode(root, text, nil), nil
+}
 
-	for _, tok := range rpnTokens {
-		switch str := tok.Str; str {
-		case string(opNot):
-			if argStack.Len() < 1 {
-				return nil, EvalError("less than 1 argument in stack; likely syntax error in RPN")
-			}
-			argStack.Push(!argStack.Pop().(bool))
-		case string(opAnd):
-			fallthrough
-		case string(opOr):
-			if argStack.Len() < 2 {
-				return nil, EvalError("less than 2 arguments in stack; likely syntax error in RPN")
-			}
-			a, b := argStack.Pop().(bool), argStack.Pop().(bool)
+// operandMatch is the outcome of matching a word, phrase or pattern against a text.
+type operandMatch struct {
+	ok    bool
+	strs  []string
+	spans []Span
+}
 
-			switch str {
-			case string(opAnd):
-				argStack.Push(a && b)
-			default:
-				argStack.Push(a || b)
-			}
-		default:
-			matches, s := containsWordOrPattern(replaceIfRegex(tok), tok.Regex, text)
-			if _, ok := auxResult[str]; ok {
+// operandCache memoizes the outcome of matching operands against a text by token, so that evaluating many expressions
+// against the same text looks up every distinct operand once.
+// Whether an operand matched is kept apart from its matches, which are only located when they are needed.
+type operandCache struct {
+	matches map[string]*operandMatch
+	found   map[string]bool
+}
 
-				// only append matched tokens into subresult if it matches and is not negated
-				if matches && !tok.Negate {
-					auxResult[str].Strings = append(auxResult[str].Strings, s...)
-				}
+func newOperandCache() *operandCache {
+	return &operandCache{matches: map[string]*operandMatch{}, found: map[string]bool{}}
+}
 
-				// new state must consider previous state if there was already a match for [str]
-				auxResult[str].OK = auxResult[str].OK || (matches && !tok.Negate)
-			} else {
-				subr := &subresult{
-					OK: matches && !tok.Negate,
-				}
+// matchOperand matches a word, phrase or pattern against text, memoizing the outcome in cache if it is not nil.
+// The returned slices must not be modified.
+func matchOperand(tok token, text *Text, cache *operandCache) *operandMatch {
+	if cache != nil {
+		if m, ok := cache.matches[tok.Str]; ok {
+			return m
+		}
+	}
 
-				if subr.OK {
-					subr.Strings = s
-				}
+	m := &operandMatch{}
+	if tok.Phrase {
+		m.ok, m.strs, m.spans = containsPhrase(tok, text)
+	} else {
+		m.ok, m.strs, m.spans = containsWordOrPattern(tok, text)
+	}
+	m = text.restore(tok, m)
 
-				auxResult[str] = subr
-			}
+	if cache != nil {
+		cache.matches[tok.Str] = m
+		cache.found[tok.Str] = m.ok
+	}
+	return m
+}
 
-			argStack.Push(matches)
+// findOperand returns whether a word, phrase or pattern matches text without locating its matches, stopping at the
+// first one. It memoizes the outcome in cache if it is not nil.
+func findOperand(tok token, text *Text, cache *operandCache) bool {
+	if cache != nil {
+		if ok, found := cache.found[tok.Str]; found {
+			return ok
 		}
 	}
 
-	var result Result
-	switch l := argStack.Len(); l {
-	case 1:
-		result.Match = argStack.Pop().(bool)
+	var ok bool
+	switch {
+	case tok.Phrase:
+		words := phraseWords(tok)
+		for _, i := range text.lookup(words[0], tok.folded()) {
+			if ok = phraseAt(words, tok.folded(), text, i); ok {
+				break
+			}
+		}
+	case tok.Regex:
+		ok = tok.pattern().MatchString(text.raw)
 	default:
-		return nil, EvalError("invalid element count in stack at end of evaluation")
+		ok = len(text.lookupFuzzy(tok.term(), tok.edits(), tok.folded())) > 0
 	}
 
-	if result.Match {
-		for _, v := range auxResult {
-			if v.OK {
-				result.Strings = append(result.Strings, v.Strings...) // result may have duplicates.
+	if cache != nil {
+		cache.found[tok.Str] = ok
+	}
+	return ok
+}
+
+// operands matches the words, phrases, patterns and proximity operators of an expression.
+type operands interface {
+	// match matches a word, phrase or pattern. The returned slices must not be modified.
+	match(tok token) *operandMatch
+	// find returns whether a word, phrase or pattern matches, which may be cheaper than locating its matches.
+	find(tok token) bool
+	// near returns whether the operands of a proximity operator, which both matched, are close enough.
+	near(n *NearNode) bool
+}
+
+// textOperands matches operands against a Text.
+type textOperands struct {
+	text  *Text
+	cache *operandCache // shared with other evaluations against text; may be nil
+}
+
+func (o textOperands) match(tok token) *operandMatch {
+	return matchOperand(tok, o.text, o.cache)
+}
+
+func (o textOperands) find(tok token) bool {
+	return findOperand(tok, o.text, o.cache)
+}
+
+func (o textOperands) near(n *NearNode) bool {
+	return withinDistance(leafToken(n.Left), leafToken(n.Right), n.Distance, o.text)
+}
+
+// evaluator evaluates the tree of an expression.
+//
+// Matches of every word, phrase and pattern that matched and is not negated (it is below an even number of NOT
+// operators) are collected. They are only reported if the expression matches.
+//
+// If short is true, operands that cannot change the outcome are skipped and matches are not collected.
+type evaluator struct {
+	ops   operands
+	short bool // short-circuit evaluation
+
+	strs  []string
+	spans []Span
+}
+
+// eval returns whether n matches. negated is whether n is below an odd number of NOT operators.
+// Unless short-circuiting, every operand is evaluated, so matches are collected even if they do not affect the outcome.
+func (ev *evaluator) eval(n Node, negated bool) bool {
+	switch n := n.(type) {
+	case *AndNode:
+		ok := true
+		for _, c := range n.Nodes {
+			if !ev.eval(c, negated) {
+				ok = false
+				if ev.short {
+					break
+				}
 			}
 		}
+		return ok
+	case *OrNode:
+		ok := false
+		for _, c := range n.Nodes {
+			if ev.eval(c, negated) {
+				ok = true
+				if ev.short {
+					break
+				}
+			}
+		}
+		return ok
+	case *NotNode:
+		return !ev.eval(n.Node, !negated)
+	case *NearNode:
+		a := ev.eval(n.Left, negated)
+		if !a && ev.short {
+			return false
+		}
+		b := ev.eval(n.Right, negated)
+		return a && b && ev.ops.near(n)
+	}
+
+	if ev.short {
+		return ev.ops.find(leafToken(n))
 	}
-	return &result, nil
+	m := ev.ops.match(leafToken(n))
+	if m.ok && !negated {
+		ev.strs = append(ev.strs, m.strs...) // result may have duplicates.
+		ev.spans = append(ev.spans, m.spans...)
+	}
+	return m.ok
+}
+
+// matchNode returns whether the tree of an expression matches text, skipping operands that cannot change the outcome.
+// Operands are only checked for a match rather than located.
+// If cache is not nil, operands are matched through a cache shared with other evaluations against the same text.
+func matchNode(root Node, text *Text, cache *operandCache) bool {
+	return evalOperands(root, textOperands{text: text, cache: cache}, true).Match
+}
+
+// evalNode evaluates the tree of an expression against text.
+// If cache is not nil, operands are matched through a cache shared with other evaluations against the same text.
+func evalNode(root Node, text *Text, cache *operandCache) *Result {
+	return evalOperands(root, textOperands{text: text, cache: cache}, false)
+}
+
+// evalOperands evaluates the tree of an expression with operands matched by ops.
+// If short is true, evaluation is short-circuited and the result only reports whether the expression matched.
+func evalOperands(root Node, ops operands, short bool) *Result {
+	ev := &evaluator{ops: ops, short: short}
+
+	var result Result
+	if result.Match = ev.eval(root, false); result.Match {
+		result.Strings, result.Spans = ev.strs, ev.spans
+		sort.Slice(result.Spans, func(i, j int) bool {
+			if result.Spans[i].Start != result.Spans[j].Start {
+				return result.Spans[i].Start < result.Spans[j].Start
+			}
+			return result.Spans[i].End < result.Spans[j].End
+		})
+	}
+	return &result
 }
 
 func replaceIfRegex(tok token) string {
 	if tok.Regex {
-		parsed := strings.ReplaceAll(tok.Str, string(opWildcardQstn), "[\\s\\S]?")
+		parsed := strings.ReplaceAll(tok.term(), string(opWildcardQstn), "[\\s\\S]?")
 		parsed = strings.ReplaceAll(parsed, string(opWildcardAst), "[\\s\\S]*?")
 		parsed = strings.ReplaceAll(parsed, string(opWildcardSpce), "[\\s]*?")
 
+		if tok.folded() {
+			parsed = "(?i)" + parsed
+		}
 		return parsed
 	}
-	return tok.Str
+	return tok.term()
 }
 
 // containsWordOrPattern matches a word or pattern against the provided text.
-// If it is not regex, will check against a set of unique words extracted from the raw text.
+// If it is not regex, will check against a set of unique words extracted from the raw text,
+// or for a fuzzy word, against a tree of them that finds the words within its edit distance.
 // If it is, will check against the raw text (which may contain non-alphanumeric characters).
-func containsWordOrPattern(s string, isRegex bool, text *Text) (bool, []string) {
-	if !isRegex {
-		ok := text.uniqueToks.Contains(s)
-		if ok {
-			return ok, []string{s}
+//
+// A word is returned once for each distinct way it is written in the text but has a span for every occurrence.
+func containsWordOrPattern(tok token, text *Text) (bool, []string, []Span) {
+	if !tok.Regex {
+		var (
+			out   []string
+			spans []Span
+			seen  = map[string]bool{}
+		)
+		for _, i := range text.lookupFuzzy(tok.term(), tok.edits(), tok.folded()) {
+			t := text.toks[i]
+			if !seen[t.str] {
+				seen[t.str] = true
+				out = append(out, t.str)
+			}
+			spans = append(spans, Span{Start: t.start, End: t.end, Token: tok.Str, Kind: SpanWord})
+		}
+		if out == nil {
+			return false, []string{}, nil
+		}
+		return true, out, spans
+	}
+
+	var (
+		out   []string
+		spans []Span
+	)
+	for _, loc := range tok.pattern().FindAllStringIndex(text.raw, -1) {
+		out = append(out, text.raw[loc[0]:loc[1]])
+		spans = append(spans, Span{Start: loc[0], End: loc[1], Token: tok.Str, Kind: SpanPattern})
+	}
+	return len(out) > 0, out, spans
+}
+
+// containsPhrase matches a sequence of words against the ordered word tokens of the provided text.
+// The words must appear consecutively and in order; each word is compared like a plain word.
+func containsPhrase(tok token, text *Text) (bool, []string, []Span) {
+	var (
+		words = phraseWords(tok)
+		out   []string
+		spans []Span
+	)
+	for _, i := range phrasePositions(words, tok.folded(), text) {
+		var b strings.Builder
+		for j := i; j < i+len(words); j++ {
+			if j > i {
+				b.WriteByte(' ')
+			}
+			b.WriteString(text.toks[j].str)
 		}
-		return ok, []string{}
+		out = append(out, b.String())
+		spans = append(spans, Span{Start: text.toks[i].start, End: text.toks[i+len(words)-1].end, Token: tok.Str, Kind: SpanPhrase})
 	}
+	if out == nil {
+		return false, []string{}, nil
+	}
+	return true, out, spans
+}
 
-	out := regexp.MustCompile(s).FindAllString(text.raw, -1)
-	return len(out) > 0, out
+// phrasePositions returns the word positions in text where a sequence of words begins.
+// If fold is true, words are compared case-insensitively.
+func phrasePositions(words []string, fold bool, text *Text) []int {
+	var out []int
+	for _, i := range text.lookup(words[0], fold) {
+		if phraseAt(words, fold, text, i) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// phraseAt returns whether a sequence of words, the first of which is at word position i in text, continues
+// consecutively after it.
+func phraseAt(words []string, fold bool, text *Text, i int) bool {
+	if i+len(words) > len(text.toks) {
+		return false
+	}
+	for j, w := range words[1:] {
+		w = text.word(w)
+		if t := text.toks[i+j+1].str; t != w && !(fold && foldCase(t) == foldCase(w)) {
+			return false
+		}
+	}
+	return true
+}
+
+// wordSpans returns the first and last word positions of every occurrence of a word or phrase token in text.
+func wordSpans(tok token, text *Text) [][2]int {
+	words := []string{tok.term()}
+	if tok.Phrase {
+		words = phraseWords(tok)
+	}
+
+	var spans [][2]int
+	for _, i := range phrasePositions(words, tok.folded(), text) {
+		spans = append(spans, [2]int{i, i + len(words) - 1})
+	}
+	return spans
+}
+
+// withinDistance reports whether an occurrence of a is within n word positions of a distinct occurrence of b.
+// The distance between two phrases is measured between their nearest words.
+func withinDistance(a, b token, n int, text *Text) bool {
+	bSpans := wordSpans(b, text)
+	for _, x := range wordSpans(a, text) {
+		for _, y := range bSpans {
+			if x == y {
+				continue
+			}
+			d := y[0] - x[1]
+			if x[0] > y[1] {
+				d = x[0] - y[1]
+			} else if d < 0 {
+				d = 0 // overlapping occurrences
+			}
+			if d <= n {
+				return true
+			}
+		}
+	}
+	return false
 }
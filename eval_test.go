@@ -1,6 +1,7 @@
 package rematch
 
 import (
+	"encoding/json"
 	"errors"
 	"reflect"
 	"sort"
@@ -452,12 +453,253 @@ func TestEvalExprToRPN(t *testing.T) {
 		}
 	})
 
+	t.Run("valid phrase expressions", func(t *testing.T) {
+		entries := []testEntry{
+			{
+				in:  `"farmers market"`,
+				out: `"farmers market"`,
+				evalRPN: []testEvalEntry{
+					{text: "at the farmers market today", shouldMatch: true, strs: []string{"farmers market"}},
+					{text: "farmers, market!", shouldMatch: true, strs: []string{"farmers market"}},
+					{text: "farmers\n  market", shouldMatch: true, strs: []string{"farmers market"}},
+					{text: "market farmers", shouldMatch: false},
+					{text: "farmers flea market", shouldMatch: false},
+					{text: "sheepfarmers marketplace", shouldMatch: false},
+					{text: "farmers market and farmers market", shouldMatch: true, strs: []string{"farmers market", "farmers market"}},
+				},
+			},
+			{
+				in:  `"  farmers   market "`, // whitespace in phrases is collapsed
+				out: `"farmers market"`,
+			},
+			{
+				in:  `"cow"`,
+				out: `"cow"`,
+				evalRPN: []testEvalEntry{
+					{text: "the cow jumped", shouldMatch: true, strs: []string{"cow"}},
+					{text: "the cows jumped", shouldMatch: false},
+				},
+			},
+			{
+				in:  `("over the moon"|"under the sea")+!cow`,
+				out: `"over the moon","under the sea",|,cow,!,+`,
+				evalRPN: []testEvalEntry{
+					{text: "the dog jumped over the moon", shouldMatch: true, strs: []string{"over the moon"}},
+					{text: "the cow jumped over the moon", shouldMatch: false},
+					{text: "the dog swam under the sea", shouldMatch: true, strs: []string{"under the sea"}},
+					{text: "the dog jumped over a moon", shouldMatch: false},
+				},
+			},
+			{
+				in:  `!"jolly cow"+moon*`,
+				out: `"jolly cow",!,moon*,+`,
+				evalRPN: []testEvalEntry{
+					{text: "the jolly cow jumped over the moon", shouldMatch: false},
+					{text: "the cow jumped over the jolly moon", shouldMatch: true, strs: []string{"moon"}},
+				},
+			},
+		}
+		for i, entry := range entries {
+			t.Run("should all pass", func(t *testing.T) {
+				testEvalHelper(t, i, entry)
+			})
+		}
+	})
+
+	t.Run("valid proximity expressions", func(t *testing.T) {
+		entries := []testEntry{
+			{
+				in:  "cow~4~moon",
+				out: "cow,moon,~4~",
+				evalRPN: []testEvalEntry{
+					{text: "the cow jumped over the moon", shouldMatch: true, strs: []string{"cow", "moon"}},
+					{text: "the moon, the cow, the farmer", shouldMatch: true, strs: []string{"cow", "moon"}},
+					{text: "the cow jumped high over the moon", shouldMatch: false},
+					{text: "the cow jumped high over the moon and the cow", shouldMatch: true, strs: []string{"cow", "moon"}},
+					{text: "the cow jumped", shouldMatch: false},
+				},
+			},
+			{
+				in:  "cow~1~cow", // two distinct occurrences are required
+				out: "cow,cow,~1~",
+				evalRPN: []testEvalEntry{
+					{text: "cow", shouldMatch: false},
+					{text: "cow cow", shouldMatch: true, strs: []string{"cow", "cow"}},
+				},
+			},
+			{
+				in:  `"jumped over"~2~moon|dog`,
+				out: `"jumped over",moon,~2~,dog,|`,
+				evalRPN: []testEvalEntry{
+					{text: "the cow jumped over the moon", shouldMatch: true, strs: []string{"jumped over", "moon"}},
+					{text: "the moon was then jumped over", shouldMatch: false},
+					{text: "the moon was then jumped over by the dog", shouldMatch: true, strs: []string{"jumped over", "moon", "dog"}},
+				},
+			},
+			{
+				in:  "!cow~04~moon+farmer",
+				out: "cow,moon,~4~,!,farmer,+",
+				evalRPN: []testEvalEntry{
+					{text: "the farmer saw the cow jump over the moon", shouldMatch: false},
+					{text: "the farmer saw the cow jump high over the moon", shouldMatch: true, strs: []string{"farmer"}},
+				},
+			},
+			{
+				in:  "farmer+(cow~2~moon)",
+				out: "farmer,cow,moon,~2~,+",
+			},
+		}
+		for i, entry := range entries {
+			t.Run("should all pass", func(t *testing.T) {
+				testEvalHelper(t, i, entry)
+			})
+		}
+	})
+
+	t.Run("valid fuzzy expressions", func(t *testing.T) {
+		entries := []testEntry{
+			{
+				in:  "colour~1",
+				out: "colour~1",
+				evalRPN: []testEvalEntry{
+					{text: "what a lovely colour", shouldMatch: true, strs: []string{"colour"}},
+					{text: "the color of the colours, not the collar", shouldMatch: true, strs: []string{"color", "colours"}},
+					{text: "recolour the Colour", shouldMatch: true, strs: []string{"Colour"}},
+					{text: "the collar", shouldMatch: false},
+				},
+			},
+			{
+				in:  "recieve~1+^THEIR~1|cow~0",
+				out: "recieve~1,^THEIR~1,+,cow,|",
+				evalRPN: []testEvalEntry{
+					{text: "Thier parcels receive care", shouldMatch: true, strs: []string{"receive", "Thier"}},
+					{text: "receive it there", shouldMatch: false},
+					{text: "a cow and a cows", shouldMatch: true, strs: []string{"cow"}},
+				},
+			},
+			{
+				in:  "!moon~2+(cow~1~moon|cow~1)",
+				out: "moon~2,!,cow,moon,~1~,cow~1,|,+",
+				evalRPN: []testEvalEntry{
+					{text: "the cow jumped over the mon", shouldMatch: false},
+					{text: "the cows jumped over the sun", shouldMatch: true, strs: []string{"cows"}},
+				},
+			},
+			{
+				in:  "café~1",
+				out: "café~1",
+				evalRPN: []testEvalEntry{
+					{text: "un cafe, des cafés", shouldMatch: true, strs: []string{"cafe", "cafés"}},
+				},
+			},
+		}
+		for i, entry := range entries {
+			t.Run("should all pass", func(t *testing.T) {
+				testEvalHelper(t, i, entry)
+			})
+		}
+	})
+
+	t.Run("valid case-insensitive expressions", func(t *testing.T) {
+		entries := []testEntry{
+			{
+				in:  "^apples+ostriches",
+				out: "^apples,ostriches,+",
+				evalRPN: []testEvalEntry{
+					{text: "Apples ducks straw, quail a ostriches", shouldMatch: true, strs: []string{"Apples", "ostriches"}},
+					{text: "APPLES and apples and Apples ostriches", shouldMatch: true, strs: []string{"APPLES", "apples", "Apples", "ostriches"}},
+					{text: "Apples ducks straw, quail a Ostriches", shouldMatch: false},
+				},
+			},
+			{
+				in:  `^"farmers market"|^*HORSE?`,
+				out: `^"farmers market",^*HORSE?,|`,
+				evalRPN: []testEvalEntry{
+					{text: "at the Farmers MARKET", shouldMatch: true, strs: []string{"Farmers MARKET"}},
+					{text: "a tool shed horse.", shouldMatch: true, strs: []string{"a tool shed horse."}},
+					{text: "farmers horsemarket", shouldMatch: true, strs: []string{"farmers horsem"}},
+				},
+			},
+			{
+				in:  "!^cow~2~^MOON",
+				out: "^cow,^MOON,~2~,!",
+				evalRPN: []testEvalEntry{
+					{text: "the Cow jumped over the Moon", shouldMatch: true},
+					{text: "the Cow saw the Moon", shouldMatch: true},
+					{text: "the Cow, the Moon", shouldMatch: false},
+				},
+			},
+		}
+		for i, entry := range entries {
+			t.Run("should all pass", func(t *testing.T) {
+				testEvalHelper(t, i, entry)
+			})
+		}
+	})
+
+	t.Run("valid unicode expressions", func(t *testing.T) {
+		entries := []testEntry{
+			{
+				in:  "café+Müller",
+				out: "café,Müller,+",
+			},
+			{
+				in:  "café|^MÜLLER",
+				out: "café,^MÜLLER,|",
+				evalRPN: []testEvalEntry{
+					{text: "un café, s'il vous plaît", shouldMatch: true, strs: []string{"café"}},
+					{text: "Herr Müller-Lüdenscheidt", shouldMatch: true, strs: []string{"Müller"}},
+					{text: "cafés and Mueller", shouldMatch: false},
+				},
+			},
+			{
+				in:  `"東京 タワー"|Москва*`,
+				out: `"東京 タワー",Москва*,|`,
+				evalRPN: []testEvalEntry{
+					{text: "東京 タワー", shouldMatch: true, strs: []string{"東京 タワー"}},
+					{text: "東京タワー", shouldMatch: false}, // words are only split on non-alphanumeric characters
+					{text: "Москва-река", shouldMatch: true, strs: []string{"Москва"}},
+				},
+			},
+			{
+				in:  "cafe\u0301", // combining marks are part of a word
+				out: "cafe\u0301",
+				evalRPN: []testEvalEntry{
+					{text: "un cafe\u0301.", shouldMatch: true, strs: []string{"cafe\u0301"}},
+					{text: "un café.", shouldMatch: false},
+				},
+			},
+		}
+		for i, entry := range entries {
+			t.Run("should all pass", func(t *testing.T) {
+				testEvalHelper(t, i, entry)
+			})
+		}
+	})
+
 	t.Run("invalid expressions", func(t *testing.T) {
 		const (
 			// tokenization errors
 			wordErr  = SyntaxError("invalid char in word; must be alphanumeric")
 			wordErr2 = SyntaxError("invalid word; cannot only contain wildcards")
 
+			// phrase errors
+			phraseErr  = SyntaxError("unterminated phrase")
+			phraseErr2 = SyntaxError("invalid phrase; must contain at least one word")
+			phraseErr3 = SyntaxError("invalid char in phrase; must be alphanumeric")
+
+			// proximity errors
+			nearErr  = SyntaxError("invalid proximity operator; want ~n~")
+			nearErr2 = SyntaxError("unexpected proximity operator, want operand")
+			nearErr3 = SyntaxError("invalid proximity operand; must be a word or phrase")
+
+			// fuzzy errors
+			fuzzyErr  = SyntaxError("invalid fuzzy operand; must be a word")
+			fuzzyErr2 = SyntaxError("invalid proximity operand; cannot be a fuzzy word")
+
+			// case modifier errors
+			foldErr = SyntaxError("unexpected case modifier; must precede a word, phrase or pattern")
+
 			// shunting errors
 			opErr     = SyntaxError("unexpected operator at end of expression, want operand")
 			opErr2    = SyntaxError("unexpected operand, want operator")
@@ -477,6 +719,8 @@ func TestEvalExprToRPN(t *testing.T) {
 			{in: "one|two+three tree", err: wordErr},
 			{in: "one|two+three&^%tree", err: wordErr},
 			{in: "\\two+thret``=ree", err: wordErr},
+			{in: "café€", err: wordErr},
+			{in: "caf\xe9", err: wordErr}, // invalid UTF-8
 			{in: "(**)", err: wordErr2},
 			{in: "***", err: wordErr2},
 			{in: "_", err: wordErr2},
@@ -485,6 +729,25 @@ func TestEvalExprToRPN(t *testing.T) {
 			{in: "??", err: wordErr2},
 			{in: "*_?*?", err: wordErr2},
 
+			// phrase errors also occur during tokenization.
+			{in: `"farmers market`, err: phraseErr},
+			{in: `"farmers"+"market`, err: phraseErr},
+			{in: `""`, err: phraseErr2},
+			{in: `hi|"   "`, err: phraseErr2},
+			{in: `"farmers* market"`, err: phraseErr3},
+			{in: `"farmers, market"`, err: phraseErr3},
+			{in: "cow~moon", err: nearErr},
+			{in: "cow~5x", err: nearErr},
+			{in: "cow~-5~moon", err: nearErr},
+			{in: "cow~~moon", err: nearErr},
+			{in: "^", err: foldErr},
+			{in: "^^cow", err: foldErr},
+			{in: "co^w", err: foldErr},
+			{in: "cow+^", err: foldErr},
+			{in: "^(cow)", err: foldErr},
+			{in: "^!cow", err: foldErr},
+			{in: "cow^~2~moon", err: foldErr},
+
 			// the following tests occur during shunting.
 			{in: "", err: opErr},
 			{in: "((hi?the***re))+", err: opErr},
@@ -511,6 +774,27 @@ func TestEvalExprToRPN(t *testing.T) {
 			{in: "(hi", err: parenErr2},
 
 			{in: "(hi)there", err: opErr2},
+			{in: `hi"there"`, err: opErr2},
+			{in: `"hi""there"`, err: opErr2},
+
+			{in: "~5~moon", err: nearErr2},
+			{in: "cow+~5~moon", err: nearErr2},
+			{in: "cow~5~", err: opErr},
+			{in: "cow~5~moon~5~farmer", err: nearErr3},
+			{in: "(cow)~5~moon", err: nearErr3},
+			{in: "cow*~5~moon", err: nearErr3},
+			{in: "cow~5~moon*", err: nearErr3},
+			{in: "cow~5~!moon", err: nearErr3},
+			{in: "cow~5~(moon)", err: nearErr3},
+
+			{in: "~1", err: fuzzyErr},
+			{in: "cow+~1", err: fuzzyErr},
+			{in: "moon*~1", err: fuzzyErr},
+			{in: `"the moon"~1`, err: fuzzyErr},
+			{in: "(cow)~1", err: fuzzyErr},
+			{in: "^~1", err: foldErr},
+			{in: "cow~1~moon~1", err: fuzzyErr2},
+			{in: "cow~1moon", err: nearErr},
 		}
 
 		for i, entry := range entries {
@@ -526,6 +810,10 @@ func TestEvalExprToRPN(t *testing.T) {
 			unaryErr = EvalError("less than 1 argument in stack; likely syntax error in RPN")
 			infixErr = EvalError("less than 2 arguments in stack; likely syntax error in RPN")
 			resErr   = EvalError("invalid element count in stack at end of evaluation")
+			nearErr  = EvalError("proximity operands must be words or phrases; likely syntax error in RPN")
+			nearErr2 = EvalError("invalid proximity operator; likely syntax error in RPN")
+			wordErr  = EvalError("empty word or pattern; likely syntax error in RPN")
+			fuzzyErr = EvalError("invalid fuzzy modifier; likely syntax error in RPN")
 		)
 
 		entries := []testInvalidRPNEntry{
@@ -533,7 +821,13 @@ func TestEvalExprToRPN(t *testing.T) {
 			{in: "hi,there,+,|", err: infixErr},
 			{in: "!", err: unaryErr},
 			{in: "hi,there", err: resErr},
-			{in: "", err: nil}, // weird edge case where the string split results in [""] input for RPN and evaluates to false with nil err
+			{in: "~2~", err: infixErr},
+			{in: "hi,there,+,you,~2~", err: nearErr},
+			{in: "hi,there,~x~", err: nearErr2},
+			{in: "hi,there,~-1~", err: nearErr2},
+			{in: "", err: wordErr}, // the string split results in [""] input for RPN, which is an empty word
+			{in: "^,hi,+", err: wordErr},
+			{in: "hi~x", err: fuzzyErr},
 		}
 
 		for i, entry := range entries {
@@ -563,7 +857,7 @@ func strsToTokens(strs []string) []token {
 // testInvalidRPNHelper exists to trigger RPN evaluation errors.
 func testInvalidRPNHelper(t *testing.T, i int, entry testInvalidRPNEntry) {
 	_, err := evalRPN(strsToTokens(strings.Split(entry.in, ",")), NewText(""))
-	if !errors.Is(entry.err, err) {
+	if !errors.Is(err, entry.err) {
 		t.Errorf("test #%d should have err='%v', but err='%v'", i+1, entry.err, err)
 	}
 }
@@ -573,9 +867,14 @@ func testInvalidRPNHelper(t *testing.T, i int, entry testInvalidRPNEntry) {
 func testEvalHelper(t *testing.T, i int, entry testEntry) {
 	rpn, err := testExprToRPN(entry.in)
 
+	// Validate must agree with compilation on whether the expression has any problems
+	if errs := Validate(entry.in); (len(errs) == 0) != (err == nil) {
+		t.Errorf("test #%d should have validated with err=%v, but errs=%v", i+1, err, errs)
+	}
+
 	switch entry.shouldFail {
 	case true:
-		if !errors.Is(entry.err, err) {
+		if !errors.Is(err, entry.err) {
 			t.Errorf("test #%d should have err=%v, but err=%v", i+1, entry.err, err)
 		}
 		return
@@ -594,10 +893,13 @@ func testEvalHelper(t *testing.T, i int, entry testEntry) {
 			t.Errorf("test #%d should have out=%s, but out=%s", i+1, entry.out, actualOut)
 			return
 		}
+		root, _ := rpnToNode(rpn)
 		for j, evalEntry := range entry.evalRPN {
 			res, err := evalRPN(rpn, NewText(evalEntry.text))
 			if err != nil {
 				t.Errorf("test #%d:%d should have err=nil, but err=%s", i+1, j+1, err.Error())
+			} else if ok := matchNode(root, NewText(evalEntry.text), nil); ok != res.Match {
+				t.Errorf("test #%d:%d should have short-circuited res=%v, but res=%v", i+1, j+1, res.Match, ok)
 			} else if res.Match != evalEntry.shouldMatch {
 				t.Errorf("test #%d:%d should have res=%v, but res=%v", i+1, j+1, evalEntry.shouldMatch, res.Match)
 			} else if !testUnorderedSliceEq(res.Strings, evalEntry.strs) {
@@ -607,3 +909,207 @@ func testEvalHelper(t *testing.T, i int, entry testEntry) {
 
 	}
 }
+
+// testSpanEntry evaluates an expression against text and compares the spans of the result.
+type testSpanEntry struct {
+	in    string
+	text  string
+	spans []Span
+}
+
+func TestEvalSpans(t *testing.T) {
+	const text = "The cow jumped over the moon. The cow is happy."
+
+	entries := []testSpanEntry{
+		{
+			in:   "cow+moon",
+			text: text,
+			spans: []Span{
+				{Start: 4, End: 7, Token: "cow", Kind: SpanWord},
+				{Start: 24, End: 28, Token: "moon", Kind: SpanWord},
+				{Start: 34, End: 37, Token: "cow", Kind: SpanWord},
+			},
+		},
+		{
+			in:   `"the moon"|cow_is`,
+			text: text,
+			spans: []Span{
+				{Start: 20, End: 28, Token: `"the moon"`, Kind: SpanPhrase},
+				{Start: 34, End: 40, Token: "cow_is", Kind: SpanPattern},
+			},
+		},
+		{
+			in:   "!dog|happy",
+			text: text,
+			spans: []Span{
+				{Start: 41, End: 46, Token: "happy", Kind: SpanWord},
+			},
+		},
+		{
+			in:   "cow+dog",
+			text: text,
+		},
+	}
+
+	for i, entry := range entries {
+		res, err := RawExprFindAll(entry.in, entry.text)
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if !reflect.DeepEqual(res.Spans, entry.spans) {
+			t.Errorf("test #%d should have spans=%v, but spans=%v", i+1, entry.spans, res.Spans)
+			continue
+		}
+		for _, span := range res.Spans {
+			if span.Kind == SpanWord && entry.text[span.Start:span.End] != span.Token {
+				t.Errorf("test #%d span %v does not locate its word", i+1, span)
+			}
+		}
+
+		// kinds are encoded by name, and decode into the same spans
+		data, err := json.Marshal(res.Spans)
+		var spans []Span
+		if err != nil || json.Unmarshal(data, &spans) != nil || !reflect.DeepEqual(spans, entry.spans) {
+			t.Errorf("test #%d should have round-tripped spans through JSON, but json=%s, err=%v", i+1, data, err)
+		}
+		for _, span := range res.Spans {
+			if kind := `"Kind":"` + span.Kind.String() + `"`; !strings.Contains(string(data), kind) {
+				t.Errorf("test #%d should have encoded %s, but json=%s", i+1, kind, data)
+			}
+		}
+	}
+
+	var kind SpanKind
+	if err := kind.UnmarshalText([]byte("sentence")); err == nil {
+		t.Errorf("should have failed to decode an unknown span kind")
+	}
+	if _, err := SpanKind(7).MarshalText(); err == nil {
+		t.Errorf("should have failed to encode an unknown span kind")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	// compose the decomposed form of é, standing in for a Unicode normalization form such as NFC
+	nfc := strings.NewReplacer("e\u0301", "\u00e9").Replace
+
+	expr := NewExpr("caf\u00e9+cre\u0301me", NormalizeExpr(nfc))
+	text := NewText("un cafe\u0301 cre\u0300me, un caf\u00e9 cr\u00e9me", NormalizeText(nfc))
+
+	res, err := FindAll(expr, text)
+	if err != nil {
+		t.Fatalf("should have err=nil, but err=%v", err)
+	}
+	if !res.Match {
+		t.Fatalf("should have matched %q", text.Raw())
+	}
+	if expected := []string{"caf\u00e9", "cr\u00e9me"}; !testUnorderedSliceEq(res.Strings, expected) {
+		t.Errorf("should have res=%v, but res=%v", expected, res.Strings)
+	}
+	for _, span := range res.Spans {
+		if s := text.Raw()[span.Start:span.End]; nfc(s) != s {
+			t.Errorf("span %v should refer to the normalized text", span)
+		}
+	}
+
+	if ok, _ := Eval(NewExpr("caf\u00e9"), NewText("un cafe\u0301")); ok {
+		t.Errorf("unnormalized text should not match")
+	}
+}
+
+// testParseErrorEntry compiles a malformed expression and checks where the problem was located.
+type testParseErrorEntry struct {
+	in     string
+	offset int
+	tok    string
+	caret  string // rendered caret line, without the expression or description
+}
+
+func TestParseError(t *testing.T) {
+	entries := []testParseErrorEntry{
+		{in: "cow++moon", offset: 4, tok: "+", caret: "    ^"},
+		{in: "cow+moon+", offset: 9, tok: "", caret: "         ^"},
+		{in: "(cow+moon", offset: 0, tok: "(", caret: "^"},
+		{in: "cow+moon)", offset: 8, tok: ")", caret: "        ^"},
+		{in: "(cow)moon", offset: 5, tok: "moon", caret: "     ^"},
+		{in: "(cow)^moon*", offset: 5, tok: "^moon*", caret: "     ^"},
+		{in: "cow+mo&on", offset: 6, tok: "&", caret: "      ^"},
+		{in: "café+mo&on", offset: 8, tok: "&", caret: "       ^"}, // offsets are bytes, but carets are aligned by runes
+		{in: "cow|***", offset: 4, tok: "***", caret: "    ^"},
+		{in: `cow|"farmers, market"`, offset: 12, tok: ",", caret: "            ^"},
+		{in: `cow|"farmers market`, offset: 4, tok: `"farmers market`, caret: "    ^"},
+		{in: "cow~x~moon", offset: 3, tok: "~x~", caret: "   ^"},
+		{in: "cow~2~moon~2~farmer", offset: 10, tok: "~2~", caret: "          ^"},
+		{in: "cow+^", offset: 5, tok: "", caret: "     ^"},
+		{in: `"cow" "moon"`, offset: 5, tok: " ", caret: "     ^"},
+	}
+
+	for i, entry := range entries {
+		err := NewExpr(entry.in).Compile()
+
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("test #%d should have err=*ParseError, but err=%v", i+1, err)
+			continue
+		}
+		if perr.Expr != entry.in || perr.Offset != entry.offset || perr.Token != entry.tok {
+			t.Errorf("test #%d should have offset=%d tok=%q, but offset=%d tok=%q", i+1, entry.offset, entry.tok, perr.Offset, perr.Token)
+			continue
+		}
+
+		lines := strings.Split(perr.Caret(), "\n")
+		if len(lines) != 2 || lines[0] != entry.in || !strings.HasPrefix(lines[1], entry.caret+" "+string(perr.Err)) {
+			t.Errorf("test #%d should have caret=%q, but caret=%q", i+1, entry.caret, perr.Caret())
+		}
+	}
+}
+
+// testShortCircuitEntry evaluates an expression against text, skipping operands that cannot change the outcome.
+type testShortCircuitEntry struct {
+	in        string
+	text      string
+	match     bool
+	evaluated []string // operands that should have been matched against text
+}
+
+func TestShortCircuit(t *testing.T) {
+	const text = "The cow jumped over the moon"
+
+	entries := []testShortCircuitEntry{
+		{in: "jolly+moon*", text: text, match: false, evaluated: []string{"jolly"}},
+		{in: "cow|moon*", text: text, match: true, evaluated: []string{"cow"}},
+		{in: "cow+moon*", text: text, match: true, evaluated: []string{"cow", "moon*"}},
+		{in: "!cow+moon*", text: text, match: false, evaluated: []string{"cow"}},
+		{in: "(jolly+farmer)|cow|moon*", text: text, match: true, evaluated: []string{"jolly", "cow"}},
+		{in: "jolly~2~moon+jump*", text: text, match: false, evaluated: []string{"jolly"}},
+		{in: "moon*+jolly", text: text, match: false, evaluated: []string{"moon*", "jolly"}},
+	}
+
+	for i, entry := range entries {
+		expr := NewExpr(entry.in)
+		root, err := expr.compile()
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+
+		cache := newOperandCache()
+		if ok := matchNode(root, NewText(entry.text), cache); ok != entry.match {
+			t.Errorf("test #%d should have res=%v, but res=%v", i+1, entry.match, ok)
+		}
+		var evaluated []string
+		for k := range cache.found {
+			evaluated = append(evaluated, k)
+		}
+		if len(cache.matches) != 0 {
+			t.Errorf("test #%d should only have checked operands for a match, but located %d", i+1, len(cache.matches))
+		}
+		if !testUnorderedSliceEq(evaluated, entry.evaluated) {
+			t.Errorf("test #%d should have evaluated=%v, but evaluated=%v", i+1, entry.evaluated, evaluated)
+		}
+
+		if ok, err := Eval(expr, NewText(entry.text)); err != nil || ok != entry.match {
+			t.Errorf("test #%d should have res=%v, but res=%v, err=%v", i+1, entry.match, ok, err)
+		}
+	}
+}
@@ -24,17 +24,18 @@ is, tool shed horse.`
 func main() {
 
 	rawExprs := []string{
-		"ostriches+Apples+horse",           // true
-		"apples+ostriches",                 // false
-		"apples|ostriches",                 // true
-		"Apples|ostriches+apples",          // false
-		"Apples|(ostriches+apples)",        // true
-		"((Apples)|((ostriches+apples)))",  // true (equivalent to previous)
-		"scared*sheep",                     // true
-		"scared?sheep",                     // false
-		"livestock_cat_hogs_chicks_trucks", // true
-		"!jolly_cow",                       // true
-		"wind*moonshine",                   // true
+		"ostriches+Apples+horse",             // true
+		"apples+ostriches",                   // false
+		"apples|ostriches",                   // true
+		"Apples|ostriches+apples",            // false
+		"Apples|(ostriches+apples)",          // true
+		"((Apples)|((ostriches+apples)))",    // true (equivalent to previous)
+		"scared*sheep",                       // true
+		"scared?sheep",                       // false
+		"livestock_cat_hogs_chicks_trucks",   // true
+		"!jolly_cow",                         // true
+		"wind*moonshine",                     // true
+		`"farmers market"+!"market farmers"`, // true
 	}
 
 	txt := rematch.NewText(example)
@@ -0,0 +1,111 @@
+package rematch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Trace is the evaluation of an operator or operand of an expression against a text, along with its inputs.
+type Trace struct {
+	Node    Node   `json:"-"`
+	Op      string // "and", "or", "not", "near", "word", "phrase" or "pattern"
+	Expr    string // the operator or operand in canonical form (see Format)
+	Match   bool
+	Negated bool // below an odd number of NOT operators, so its matches are not reported by FindAll
+
+	// Strings and Spans are the matches of a word, phrase or pattern, whether or not it is negated.
+	Strings []string `json:",omitempty"`
+	Spans   []Span   `json:",omitempty"`
+
+	// Inputs are the traces of the operands of an operator, in order.
+	Inputs []*Trace `json:",omitempty"`
+}
+
+// Explain evaluates an expression against text like FindAll, but returns the evaluation of every operator and
+// operand rather than the result. Every operand is evaluated, even if it cannot change the outcome.
+func Explain(expr *Expr, text *Text) (*Trace, error) {
+	root, err := expr.compile()
+	if err != nil {
+		return nil, err
+	}
+	return explainNode(root, textOperands{text: text}, false), nil
+}
+
+// explainNode evaluates n like evaluator.eval and traces it. negated is whether n is below an odd number of NOT operators.
+func explainNode(n Node, ops operands, negated bool) *Trace {
+	t := &Trace{Node: n, Expr: formatNode(n), Negated: negated}
+	switch n := n.(type) {
+	case *AndNode:
+		t.Op, t.Match = "and", true
+		for _, c := range n.Nodes {
+			in := explainNode(c, ops, negated)
+			t.Inputs = append(t.Inputs, in)
+			t.Match = t.Match && in.Match
+		}
+	case *OrNode:
+		t.Op = "or"
+		for _, c := range n.Nodes {
+			in := explainNode(c, ops, negated)
+			t.Inputs = append(t.Inputs, in)
+			t.Match = t.Match || in.Match
+		}
+	case *NotNode:
+		in := explainNode(n.Node, ops, !negated)
+		t.Op, t.Match, t.Inputs = "not", !in.Match, []*Trace{in}
+	case *NearNode:
+		a, b := explainNode(n.Left, ops, negated), explainNode(n.Right, ops, negated)
+		t.Op, t.Inputs = "near", []*Trace{a, b}
+		t.Match = a.Match && b.Match && ops.near(n)
+	default:
+		tok := leafToken(n)
+		m := ops.match(tok)
+		t.Match, t.Strings, t.Spans = m.ok, m.strs, m.spans
+		switch {
+		case tok.Phrase:
+			t.Op = "phrase"
+		case tok.Regex:
+			t.Op = "pattern"
+		default:
+			t.Op = "word"
+		}
+	}
+	return t
+}
+
+// String renders the trace as an indented tree, one operator or operand per line. For example, "cow+!moon" against
+// "the cow jumped over the moon" is rendered as:
+//
+//	and cow+!moon: false
+//	  word cow: true ["cow"]
+//	  not !moon: false, flipped from true
+//	    word moon: true ["moon"] (negated)
+func (t *Trace) String() string {
+	var b strings.Builder
+	t.write(&b, 0)
+	return b.String()
+}
+
+func (t *Trace) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%s %s: %v", strings.Repeat("  ", depth), t.Op, t.Expr, t.Match)
+	switch t.Op {
+	case "and", "or":
+	case "not":
+		fmt.Fprintf(b, ", flipped from %v", t.Inputs[0].Match)
+	case "near":
+		if n, ok := t.Node.(*NearNode); ok && !t.Match && t.Inputs[0].Match && t.Inputs[1].Match {
+			fmt.Fprintf(b, ", not within %d words", n.Distance)
+		}
+	default:
+		if len(t.Strings) > 0 {
+			fmt.Fprintf(b, " %q", t.Strings)
+		}
+		if t.Negated {
+			b.WriteString(" (negated)")
+		}
+	}
+	b.WriteByte('\n')
+
+	for _, in := range t.Inputs {
+		in.write(b, depth+1)
+	}
+}
@@ -0,0 +1,70 @@
+package rematch
+
+import (
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	text := "The cow jumped over the moon, and the Cow said moo"
+
+	entries := []struct {
+		raw      string
+		opts     []ExprOption
+		expected string
+	}{
+		{
+			raw:      "cow",
+			expected: "word cow: true [\"cow\"]\n",
+		},
+		{
+			raw: "cow+!moon",
+			expected: "and cow+!moon: false\n" +
+				"  word cow: true [\"cow\"]\n" +
+				"  not !moon: false, flipped from true\n" +
+				"    word moon: true [\"moon\"] (negated)\n",
+		},
+		{
+			raw:  `(cow|"farmers market")+!(jump*+farmer)`,
+			opts: []ExprOption{IgnoreCase()},
+			expected: "and (^cow|^\"farmers market\")+!(^jump*+^farmer): true\n" +
+				"  or ^cow|^\"farmers market\": true\n" +
+				"    word ^cow: true [\"cow\" \"Cow\"]\n" +
+				"    phrase ^\"farmers market\": false\n" +
+				"  not !(^jump*+^farmer): true, flipped from false\n" +
+				"    and ^jump*+^farmer: false\n" +
+				"      pattern ^jump*: true [\"jump\"] (negated)\n" +
+				"      word ^farmer: false (negated)\n",
+		},
+		{
+			raw: "cow~2~moon|!!said",
+			expected: "or cow~2~moon|!!said: true\n" +
+				"  near cow~2~moon: false, not within 2 words\n" +
+				"    word cow: true [\"cow\"]\n" +
+				"    word moon: true [\"moon\"]\n" +
+				"  not !!said: true, flipped from false\n" +
+				"    not !said: false, flipped from true\n" +
+				"      word said: true [\"said\"]\n",
+		},
+	}
+
+	for i, entry := range entries {
+		expr := NewExpr(entry.raw, entry.opts...)
+		trace, err := Explain(expr, NewText(text))
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if s := trace.String(); s != entry.expected {
+			t.Errorf("test #%d should have trace\n%s\nbut trace\n%s", i+1, entry.expected, s)
+		}
+
+		res, _ := FindAll(expr, NewText(text))
+		if trace.Match != res.Match {
+			t.Errorf("test #%d should have match=%v like FindAll, but match=%v", i+1, res.Match, trace.Match)
+		}
+	}
+
+	if _, err := Explain(NewExpr("cow+"), NewText(text)); err == nil {
+		t.Errorf("should have failed to explain a malformed expression")
+	}
+}
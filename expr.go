@@ -2,20 +2,95 @@ package rematch
 
 import (
 	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 // Expr represents a Rematch expression.
+//
+// An Expr is safe for concurrent use by multiple goroutines once it has been created.
+// It is compiled at most once, either explicitly with Compile or on its first evaluation; a malformed expression
+// is not compiled again, but reports the same error every time. Once compiled, evaluations do not contend on a lock.
+// UnmarshalJSON must not be called while the expression is in use.
 type Expr struct {
-	raw      string  // raw expression
-	rpn      []token // expression in RPN form
-	compiled bool    // determines if the raw expression was already converted to RPN
+	mu    sync.Mutex   // serializes compilation
+	state atomic.Value // *exprState; nil until the raw expression has been parsed
+
+	raw        string // raw expression
+	ignoreCase bool   // match every word, phrase and pattern case-insensitively
+	lenient    bool   // Eval discards errors and reports no match
+	optimize   bool   // simplify the expression when it is compiled
+	err        error  // problem found while building the expression; returned instead of compiling it
+
+	normalize func(string) string // applied to the raw expression before it is tokenized
+	tokenizer Tokenizer           // words must be single words to it; if nil, words must be alphanumeric
+}
+
+// exprState is the outcome of compiling an expression. It is never modified once stored.
+type exprState struct {
+	root Node    // expression tree
+	rpn  []token // expression in RPN form, derived from root
+	err  error   // problem that prevented the expression from compiling; root and rpn are nil if set
+}
+
+// compiled returns the outcome of compiling the expression, or nil if it has not been compiled.
+func (e *Expr) compiled() *exprState {
+	st, _ := e.state.Load().(*exprState)
+	return st
+}
+
+// ExprOption configures an Expr.
+type ExprOption func(*Expr)
+
+// IgnoreCase matches every word, phrase and pattern of the expression case-insensitively,
+// as if each of them was prefixed with the ^ case modifier.
+func IgnoreCase() ExprOption {
+	return func(e *Expr) {
+		e.ignoreCase = true
+	}
+}
+
+// Lenient makes Eval, EvalExpr and EvalRawExpr report a malformed expression as a non-match rather than an error.
+// This is the behavior of those functions prior to errors being returned, and is only meant for compatibility;
+// an invalid expression will silently never match. FindAll and related functions always return errors.
+// It is not included in the JSON form of an expression.
+func Lenient() ExprOption {
+	return func(e *Expr) {
+		e.lenient = true
+	}
+}
+
+// NormalizeExpr transforms the raw expression with f before it is compiled.
+// It should be the same normalization given to NormalizeText so words in the expression and text agree.
+// A normalizer is not included in the JSON form of an expression; it must be given again before an
+// uncompiled expression is compiled.
+func NormalizeExpr(f func(string) string) ExprOption {
+	return func(e *Expr) {
+		e.normalize = f
+	}
 }
 
 // NewExpr returns a new Expression for evaluation.
-func NewExpr(rawExpr string) *Expr {
-	return &Expr{
+func NewExpr(rawExpr string, opts ...ExprOption) *Expr {
+	e := &Expr{
 		raw: rawExpr,
 	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// MustCompile returns a new compiled Expression for evaluation.
+// It panics if the expression is malformed. This simplifies the initialization of global variables holding expressions.
+func MustCompile(rawExpr string, opts ...ExprOption) *Expr {
+	e := NewExpr(rawExpr, opts...)
+	if err := e.Compile(); err != nil {
+		panic(`rematch: MustCompile(` + strconv.Quote(rawExpr) + `): ` + err.Error())
+	}
+	return e
 }
 
 // Raw returns the raw expression string before conversion into Reverse Polish notation.
@@ -25,64 +100,146 @@ func (e *Expr) Raw() string {
 }
 
 // RPN returns the expression in Reverse Polish notation.
+// It is a view of the tree returned by AST and is empty until the expression is compiled.
 func (e *Expr) RPN() []string {
+	st := e.compiled()
+	if st == nil {
+		return nil
+	}
+
 	var s []string
-	for i := range e.rpn {
-		s = append(s, e.rpn[i].Str)
+	for i := range st.rpn {
+		s = append(s, st.rpn[i].Str)
 	}
 	return s
 }
 
+// AST returns the abstract syntax tree of the expression, or nil if it has not been compiled.
+// The tree must not be modified.
+func (e *Expr) AST() Node {
+	if st := e.compiled(); st != nil {
+		return st.root
+	}
+	return nil
+}
+
 // Compiled returns if the expression has been compiled into Reverse Polish notation.
 func (e *Expr) Compiled() bool {
-	return e.compiled
+	st := e.compiled()
+	return st != nil && st.err == nil
 }
 
 // Compile an expression.
-// A compiled expression will not be recompiled. This is useful when reusing an expression multiple times against different texts
+// A compiled expression will not be recompiled. This is useful when reusing an expression multiple times against different texts.
+// Patterns are compiled into regular expressions once, when the expression is compiled.
 func (e *Expr) Compile() error {
-	if e.compiled {
-		return nil
+	_, err := e.compile()
+	return err
+}
+
+// compile compiles the expression if necessary and returns its tree.
+// Once the expression has been compiled, its outcome is loaded without holding mu, and the tree is never modified.
+func (e *Expr) compile() (Node, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	if st := e.compiled(); st != nil {
+		return st.root, st.err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := e.compiled() // compiled by another goroutine while waiting for mu
+	if st == nil {
+		st = e.parse()
+		e.state.Store(st)
+	}
+	return st.root, st.err
+}
+
+// parse parses, optimizes and precompiles the raw expression.
+func (e *Expr) parse() *exprState {
+	raw := e.raw
+	if e.normalize != nil {
+		raw = e.normalize(raw)
 	}
-	toks, err := tokenizeExpr(e.raw)
+	toks, err := scanExpr(raw, e.tokenizer, nil)
 	if err != nil {
-		return err
+		return &exprState{err: withExpr(err, raw)}
 	}
-	rpn, err := shuntingYard(toks)
+	root, err := shunt(toks, nil)
 	if err != nil {
-		return err
+		return &exprState{err: withExpr(err, raw)}
+	}
+	if e.ignoreCase {
+		foldNode(root)
+	}
+	if e.optimize {
+		root = optimize(root)
+	}
+	if err := compileNode(root); err != nil {
+		return &exprState{err: err}
+	}
+	return &exprState{root: root, rpn: rpnTokens(root)}
+}
+
+// Validate checks a raw expression for every problem that prevents it from compiling, rather than stopping at the first.
+// Each problem is returned as a *ParseError, ordered by offset. A valid expression has no problems.
+func Validate(rawExpr string, opts ...ExprOption) []error {
+	e := NewExpr(rawExpr, opts...)
+	raw := e.raw
+	if e.normalize != nil {
+		raw = e.normalize(raw)
 	}
 
-	e.rpn = rpn
-	e.compiled = true
+	var errs []error
+	toks, _ := scanExpr(raw, e.tokenizer, &errs)
+	_, _ = shunt(toks, &errs)
 
-	return nil
+	for _, err := range errs {
+		_ = withExpr(err, raw)
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].(*ParseError).Offset < errs[j].(*ParseError).Offset
+	})
+	return errs
+}
+
+// withExpr sets the raw expression of a *ParseError so it can be rendered.
+func withExpr(err error, raw string) error {
+	if perr, ok := err.(*ParseError); ok {
+		perr.Expr = raw
+	}
+	return err
 }
 
 type exprJSON struct {
-	Raw      string  `json:"raw"`
-	Rpn      []token `json:"rpn"`
-	Compiled bool    `json:"compiled"`
+	Raw        string  `json:"raw"`
+	Rpn        []token `json:"rpn"`
+	Compiled   bool    `json:"compiled"`
+	IgnoreCase bool    `json:"ignoreCase,omitempty"`
+	Optimize   bool    `json:"optimize,omitempty"`
 }
 
 // MarshalJSON implements JSON marshalling
 func (e *Expr) MarshalJSON() ([]byte, error) {
-
-	var rpn []token
-	if e.rpn == nil {
-		rpn = []token{}
-	} else {
-		rpn = e.rpn
+	rpn := []token{}
+	if st := e.compiled(); st != nil && st.rpn != nil {
+		rpn = st.rpn
 	}
 
 	return json.Marshal(&exprJSON{
-		Raw:      e.raw,
-		Rpn:      rpn,
-		Compiled: e.compiled,
+		Raw:        e.raw,
+		Rpn:        rpn,
+		Compiled:   e.Compiled(),
+		IgnoreCase: e.ignoreCase,
+		Optimize:   e.optimize,
 	})
 }
 
-// UnmarshalJSON implements JSON unmarshalling
+// UnmarshalJSON implements JSON unmarshalling.
+// The tree of a compiled expression is rebuilt from its RPN form, and its patterns are compiled into regular expressions eagerly.
 func (e *Expr) UnmarshalJSON(data []byte) error {
 	aux := &exprJSON{}
 	err := json.Unmarshal(data, aux)
@@ -90,9 +247,22 @@ func (e *Expr) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var st *exprState // an expression that was not compiled is compiled again from its raw form
+	if aux.Compiled {
+		root, err := rpnToNode(aux.Rpn)
+		if err != nil {
+			return err
+		}
+		st = &exprState{root: root, rpn: aux.Rpn}
+	}
+
 	e.raw = aux.Raw
-	e.rpn = aux.Rpn
-	e.compiled = aux.Compiled
+	e.state.Store(st)
+	e.ignoreCase = aux.IgnoreCase
+	e.optimize = aux.Optimize
 
 	return nil
 }
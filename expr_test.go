@@ -3,13 +3,16 @@ package rematch
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 )
 
 // testExprEntry has similar functionality to testEntry, but is tuned for testing Expr type.
 type testExprEntry struct {
 	raw          string
+	opts         []ExprOption
 	expectedRPN  string // comma joined RPN queue output
 	shouldFail   bool
 	err          error // err to expect if compile failed
@@ -49,6 +52,36 @@ func TestExpr(t *testing.T) {
 					{text: "fish", shouldMatch: false},
 				},
 			},
+			{
+				raw:          `apples+^"farmers market"|fish*`,
+				opts:         []ExprOption{IgnoreCase()},
+				expectedRPN:  `^apples,^"farmers market",+,^fish*,|`,
+				expectedJSON: `{"raw":"apples+^\"farmers market\"|fish*","rpn":[{"s":"^apples"},{"s":"^\"farmers market\"","p":1},{"s":"+"},{"s":"^fish*","r":1},{"s":"|"}],"compiled":true,"ignoreCase":true}`,
+				evalRPN: []testEvalEntry{
+					{text: "Apples at the Farmers Market", shouldMatch: true, strs: []string{"Apples", "Farmers Market"}},
+					{text: "FISH", shouldMatch: true, strs: []string{"FISH"}},
+					{text: "apples", shouldMatch: false},
+				},
+			},
+			{
+				raw:          "!!(fish*+(apples+pears))",
+				opts:         []ExprOption{Optimize()},
+				expectedRPN:  "apples,pears,+,fish*,+",
+				expectedJSON: `{"raw":"!!(fish*+(apples+pears))","rpn":[{"s":"apples"},{"s":"pears"},{"s":"+"},{"s":"fish*","r":1},{"s":"+"}],"compiled":true,"optimize":true}`,
+				evalRPN: []testEvalEntry{
+					{text: "fish and apples and pears", shouldMatch: true, strs: []string{"fish", "apples", "pears"}},
+					{text: "apples and pears", shouldMatch: false},
+				},
+			},
+			{
+				raw:          "colour~1+^FISH~2",
+				expectedRPN:  "colour~1,^FISH~2,+",
+				expectedJSON: `{"raw":"colour~1+^FISH~2","rpn":[{"s":"colour~1"},{"s":"^FISH~2"},{"s":"+"}],"compiled":true}`,
+				evalRPN: []testEvalEntry{
+					{text: "a fsh of every color", shouldMatch: true, strs: []string{"fsh", "color"}},
+					{text: "a fish of every hue", shouldMatch: false},
+				},
+			},
 		}
 
 		for i, entry := range entries {
@@ -75,11 +108,184 @@ func TestExpr(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid pattern in JSON", func(t *testing.T) {
+		var expr *Expr
+		err := json.Unmarshal([]byte(`{"raw":"a*","rpn":[{"s":"a(*","r":1}],"compiled":true}`), &expr)
+		if !errors.Is(err, SyntaxError("invalid pattern")) {
+			t.Errorf("should have err=%v, but err=%v", SyntaxError("invalid pattern"), err)
+		}
+	})
+
+	t.Run("malformed operand in JSON", func(t *testing.T) {
+		for i, data := range []string{
+			`{"raw":"x","rpn":[{"s":"\"\"","p":1}],"compiled":true}`,
+			`{"raw":"x","rpn":[{"s":"\"  \"","p":1}],"compiled":true}`,
+			`{"raw":"x","rpn":[{"s":""}],"compiled":true}`,
+			`{"raw":"x","rpn":[{"s":"^","r":1}],"compiled":true}`,
+		} {
+			var expr *Expr
+			var evalErr EvalError
+			if err := json.Unmarshal([]byte(data), &expr); !errors.As(err, &evalErr) {
+				t.Errorf("test #%d should have an EvalError, but err=%v", i+1, err)
+			}
+		}
+	})
+
+}
+
+// TestExprConcurrent evaluates a shared expression from many goroutines; run with -race to detect data races.
+func TestExprConcurrent(t *testing.T) {
+	const goroutines = 32
+
+	var (
+		expr   = NewExpr(`(^cow|"farmer brown")+moon*+!jolly`) // compiled lazily by the first evaluation
+		shared = NewText("The Cow jumped over the moon while farmer brown watched")
+		wg     sync.WaitGroup
+	)
+
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// half of the texts should match
+			text := NewText(fmt.Sprintf("cow %d jumped over the moon", i))
+			if i%2 == 1 {
+				text = NewText(fmt.Sprintf("the jolly cow %d jumped over the moon", i))
+			}
+
+			res, err := FindAll(expr, text)
+			if err != nil {
+				t.Errorf("goroutine #%d should have err=nil, but err=%v", i, err)
+				return
+			}
+			if res.Match != (i%2 == 0) {
+				t.Errorf("goroutine #%d should have res=%v, but res=%v", i, i%2 == 0, res.Match)
+			}
+
+			if ok, err := Eval(expr, shared); err != nil || !ok {
+				t.Errorf("goroutine #%d should have matched the shared text, but res=%v err=%v", i, ok, err)
+			}
+			_ = expr.Compiled()
+			_ = expr.RPN()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCompileError(t *testing.T) {
+	// a malformed expression is only parsed once, and reports the same error from then on
+	expr := NewExpr("cow+", Lenient())
+	err := expr.Compile()
+	if err == nil || expr.Compiled() || expr.RPN() != nil {
+		t.Fatalf("should have failed to compile, but err=%v", err)
+	}
+	if again := expr.Compile(); again != err {
+		t.Errorf("should have err=%v again, but err=%v", err, again)
+	}
+	if ok, err := Eval(expr, NewText("cow")); ok || err != nil {
+		t.Errorf("should have res=false err=nil, but res=%v err=%v", ok, err)
+	}
+}
+
+func TestMustCompile(t *testing.T) {
+	expr := MustCompile("cow+moon*")
+	if !expr.Compiled() {
+		t.Errorf("should have been compiled")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("should have panicked on a malformed expression")
+		}
+	}()
+	MustCompile("cow+")
+}
+
+// testValidateEntry validates a raw expression, expecting a problem at each offset.
+type testValidateEntry struct {
+	raw     string
+	offsets []int
+	errs    []error
+}
+
+func TestValidate(t *testing.T) {
+	entries := []testValidateEntry{
+		{raw: `(cow|"farmers market")+^moon*`},
+		{
+			raw:     "cow++moon|(farm&er",
+			offsets: []int{4, 10, 15},
+			errs: []error{
+				SyntaxError("unexpected infix operator, want operand"),
+				SyntaxError("mismatched parenthesis at end of expression"),
+				SyntaxError("invalid char in word; must be alphanumeric"),
+			},
+		},
+		{
+			raw:     `"farmers, market"~x~^^moon)+`,
+			offsets: []int{8, 17, 21, 26, 28},
+			errs: []error{
+				SyntaxError("invalid char in phrase; must be alphanumeric"),
+				SyntaxError("invalid proximity operator; want ~n~"),
+				SyntaxError("unexpected case modifier; must precede a word, phrase or pattern"),
+				SyntaxError("mismatched parenthesis"),
+				SyntaxError("unexpected operator at end of expression, want operand"),
+			},
+		},
+		{
+			raw:     `!cow!*** "moon`,
+			offsets: []int{4, 5, 8, 9, 9},
+			errs: []error{
+				SyntaxError("unexpected negation"),
+				SyntaxError("invalid word; cannot only contain wildcards"),
+				SyntaxError("invalid char in word; must be alphanumeric"),
+				SyntaxError("unterminated phrase"),
+				SyntaxError("unexpected operand, want operator"),
+			},
+		},
+		{
+			raw:     "()cow",
+			offsets: []int{1, 2},
+			errs: []error{
+				SyntaxError("unexpected right parenthesis"),
+				SyntaxError("unexpected operand, want operator"),
+			},
+		},
+	}
+
+	for i, entry := range entries {
+		errs := Validate(entry.raw)
+		if len(errs) != len(entry.errs) {
+			t.Errorf("test #%d should have %d errs, but errs=%v", i+1, len(entry.errs), errs)
+			continue
+		}
+		for j, err := range errs {
+			var perr *ParseError
+			if !errors.As(err, &perr) || !errors.Is(err, entry.errs[j]) || perr.Offset != entry.offsets[j] || perr.Expr != entry.raw {
+				t.Errorf("test #%d:%d should have err=%v at offset %d, but err=%v", i+1, j+1, entry.errs[j], entry.offsets[j], err)
+			}
+		}
+
+		// an expression has problems if and only if it fails to compile
+		if err := NewExpr(entry.raw).Compile(); (err == nil) != (len(errs) == 0) {
+			t.Errorf("test #%d compiled with err=%v, but errs=%v", i+1, err, errs)
+		}
+	}
+}
+
+// testPatternsCompiled returns whether every pattern in rpn has a precompiled regular expression.
+func testPatternsCompiled(rpn []token) bool {
+	for _, tok := range rpn {
+		if tok.Regex && tok.re == nil {
+			return false
+		}
+	}
+	return true
 }
 
 // testExprHelper tests Expr type functionality
 func testExprHelper(t *testing.T, i int, entry testExprEntry) {
-	expr := NewExpr(entry.raw)
+	expr := NewExpr(entry.raw, entry.opts...)
 	err := expr.Compile()
 
 	if expr.Raw() != entry.raw {
@@ -89,7 +295,7 @@ func testExprHelper(t *testing.T, i int, entry testExprEntry) {
 
 	switch entry.shouldFail {
 	case true:
-		if !errors.Is(entry.err, err) {
+		if !errors.Is(err, entry.err) {
 			t.Errorf("test #%d should have err=%v, but err=%v", i+1, entry.err, err)
 		}
 
@@ -119,6 +325,10 @@ func testExprHelper(t *testing.T, i int, entry testExprEntry) {
 		t.Errorf("test #%d should have been compiled", i+1)
 		return
 	}
+	if !testPatternsCompiled(expr.compiled().rpn) {
+		t.Errorf("test #%d should have compiled all patterns", i+1)
+		return
+	}
 
 	// test JSON unmarshal/marshal
 	var temp *Expr
@@ -126,6 +336,10 @@ func testExprHelper(t *testing.T, i int, entry testExprEntry) {
 		t.Errorf("test #%d failed JSON unmarshal", i+1)
 		return
 	}
+	if !testPatternsCompiled(temp.compiled().rpn) {
+		t.Errorf("test #%d should have compiled all patterns after JSON unmarshal", i+1)
+		return
+	}
 	jsonBytes, err := json.Marshal(&temp)
 	if err != nil {
 		t.Errorf("test #%d failed JSON marshal", i+1)
@@ -135,7 +349,7 @@ func testExprHelper(t *testing.T, i int, entry testExprEntry) {
 		t.Errorf("test #%d failed JSON comparison. Should have json='%s', but json='%s'", i+1, entry.expectedJSON, jsonBytes)
 	}
 
-	if compiledRPN := strings.Join(tokensToStrs(expr.rpn), ","); compiledRPN != entry.expectedRPN {
+	if compiledRPN := strings.Join(tokensToStrs(expr.compiled().rpn), ","); compiledRPN != entry.expectedRPN {
 		t.Errorf("test #%d should have out=[%s], but out=[%s]", i+1, entry.expectedRPN, compiledRPN)
 		return
 	}
@@ -151,3 +365,44 @@ func testExprHelper(t *testing.T, i int, entry testExprEntry) {
 	}
 
 }
+
+func BenchmarkFindAll(b *testing.B) {
+	expr := NewExpr("((hi?the***re+*howdy?))|(dog+g*D)")
+	text := NewText(strings.Repeat("well hi there, howdy partner. The dog barked at the goD. ", 20))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := FindAll(expr, text); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEvalLarge evaluates expressions against a large text, where only whether each operand matches is needed.
+func BenchmarkEvalLarge(b *testing.B) {
+	text := NewText(strings.Repeat("The cow jumped over the moon. The dish ran away with the spoon. ", 16000))
+
+	for _, raw := range []string{"moon*t", "cow", `"the spoon"`, "jolly|cow"} {
+		expr := MustCompile(raw)
+		b.Run(raw, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if ok, err := Eval(expr, text); err != nil || !ok {
+					b.Fatalf("should have matched, but res=%v err=%v", ok, err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	expr := NewExpr("cat+(hi?the***re|*howdy?|g*D)", Optimize())
+	text := NewText(strings.Repeat("well hi there, howdy partner. The dog barked at the goD. ", 20))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Eval(expr, text); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
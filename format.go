@@ -0,0 +1,92 @@
+package rematch
+
+import (
+	"strings"
+)
+
+// Format returns the canonical form of an expression.
+//
+// Grouping is made explicit by parentheses wherever the left to right evaluation of AND and OR operators would
+// otherwise be ambiguous to a reader, so "Apples|ostriches+apples" is formatted as "(Apples|ostriches)+apples".
+// Redundant parentheses are removed, so "((Apples))" is formatted as "Apples", and adjacent wildcards are collapsed,
+// so "tasty__" is formatted as "tasty_". Case-insensitivity from the IgnoreCase option is written out as case modifiers.
+//
+// The canonical form compiles into the same RPN form as the expression.
+func Format(expr *Expr) (string, error) {
+	root, err := expr.compile()
+	if err != nil {
+		return "", err
+	}
+	return formatNode(root), nil
+}
+
+// formatNode renders a tree as a raw expression that parses back into an equivalent tree with the same RPN form.
+// Parentheses are only written where they are required: around an AND or OR operand of a NOT operator,
+// around the operand of an AND or OR operator that is a different one of the two, and around the
+// operands after the first when they are AND or OR operators themselves, since operators are evaluated left to right.
+func formatNode(n Node) string {
+	var b strings.Builder
+	writeNode(&b, n)
+	return b.String()
+}
+
+func writeNode(b *strings.Builder, n Node) {
+	switch n := n.(type) {
+	case *AndNode:
+		writeInfix(b, n, n.Nodes, opAnd)
+	case *OrNode:
+		writeInfix(b, n, n.Nodes, opOr)
+	case *NotNode:
+		b.WriteByte(opNot)
+		writeOperand(b, n.Node, isInfix(n.Node))
+	case *NearNode:
+		writeNode(b, n.Left)
+		b.WriteString(nearTok(n.Distance).Str)
+		writeNode(b, n.Right)
+	default:
+		b.WriteString(leafToken(n).Str)
+	}
+}
+
+// writeInfix writes the operands of an AND or OR operator n separated by op.
+func writeInfix(b *strings.Builder, n Node, nodes []Node, op byte) {
+	for i, c := range nodes {
+		if i > 0 {
+			b.WriteByte(op)
+		}
+		writeOperand(b, c, isInfix(c) && (i > 0 || !sameOp(n, c)))
+	}
+}
+
+// writeOperand writes n, in parentheses if paren is true.
+func writeOperand(b *strings.Builder, n Node, paren bool) {
+	if paren {
+		b.WriteByte(opGroupL)
+	}
+	writeNode(b, n)
+	if paren {
+		b.WriteByte(opGroupR)
+	}
+}
+
+// isInfix returns whether n is an AND or OR operator.
+func isInfix(n Node) bool {
+	switch n.(type) {
+	case *AndNode, *OrNode:
+		return true
+	}
+	return false
+}
+
+// sameOp returns whether a and b are both AND operators or both OR operators.
+func sameOp(a, b Node) bool {
+	switch a.(type) {
+	case *AndNode:
+		_, ok := b.(*AndNode)
+		return ok
+	case *OrNode:
+		_, ok := b.(*OrNode)
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package rematch
+
+import (
+	"strings"
+	"testing"
+)
+
+// testFormatEntry formats an expression into its canonical form.
+type testFormatEntry struct {
+	in   string
+	opts []ExprOption
+	out  string
+}
+
+func TestFormat(t *testing.T) {
+	entries := []testFormatEntry{
+		{in: "Apples", out: "Apples"},
+		{in: "((Apples))", out: "Apples"},
+		{in: "Apples|ostriches+apples", out: "(Apples|ostriches)+apples"},
+		{in: "Apples|(ostriches+apples)", out: "Apples|(ostriches+apples)"},
+		{in: "((Apples)|((ostriches+apples)))", out: "Apples|(ostriches+apples)"},
+		{in: "(a+b)+(c+d)", out: "a+b+(c+d)"},
+		{in: "a|b|c+d", out: "(a|b|c)+d"},
+		{in: "tasty__", out: "tasty_"},
+		{in: "scared**sheep", out: "scared*sheep"},
+		{in: "!(jolly)", out: "!jolly"},
+		{in: "!(jolly|cow)", out: "!(jolly|cow)"},
+		{in: "!!(jolly)", out: "!!jolly"},
+		{in: "(!cow~1~moon)", out: "!cow~1~moon"},
+		{in: "(^colour~01)|cow~0", out: "^colour~1|cow"},
+		{in: `"farmers   market"+("the"|^moon*)`, out: `"farmers market"+("the"|^moon*)`},
+		{in: "cow+moon*", opts: []ExprOption{IgnoreCase()}, out: "^cow+^moon*"},
+	}
+
+	for i, entry := range entries {
+		expr := NewExpr(entry.in, entry.opts...)
+		out, err := Format(expr)
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if out != entry.out {
+			t.Errorf("test #%d should have out=%s, but out=%s", i+1, entry.out, out)
+			continue
+		}
+
+		// the canonical form must compile into the same RPN form
+		formatted := NewExpr(out)
+		if err := formatted.Compile(); err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if rpn, expectedRPN := strings.Join(formatted.RPN(), ","), strings.Join(expr.RPN(), ","); rpn != expectedRPN {
+			t.Errorf("test #%d should have rpn=%s, but rpn=%s", i+1, expectedRPN, rpn)
+		}
+	}
+
+	if _, err := Format(NewExpr("cow+")); err == nil {
+		t.Errorf("should have failed to format a malformed expression")
+	}
+}
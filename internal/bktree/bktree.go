@@ -0,0 +1,143 @@
+// Package bktree implements a BK-tree, which finds the strings within an edit distance of a string
+// without comparing it to every string in the tree.
+package bktree
+
+import (
+	"sort"
+)
+
+// Tree is a BK-tree of strings under the Damerau-Levenshtein distance. Not thread-safe.
+type Tree struct {
+	root *node
+	size int
+}
+
+type node struct {
+	word     string
+	children map[int]*node // by distance from word
+}
+
+// New creates a tree of zero or more strings.
+func New(words ...string) *Tree {
+	t := &Tree{}
+	for _, w := range words {
+		_ = t.Add(w)
+	}
+	return t
+}
+
+// Add adds a string to the tree, will return false if it exists
+func (t *Tree) Add(word string) bool {
+	if t.root == nil {
+		t.root = &node{word: word}
+		t.size++
+		return true
+	}
+
+	n := t.root
+	for {
+		d := Distance(word, n.word)
+		if d == 0 {
+			return false
+		}
+		child, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = map[int]*node{}
+			}
+			n.children[d] = &node{word: word}
+			t.size++
+			return true
+		}
+		n = child
+	}
+}
+
+// Search returns the strings of the tree within distance n of word, in sorted order.
+func (t *Tree) Search(word string, n int) []string {
+	if t.root == nil || n < 0 {
+		return nil
+	}
+
+	var (
+		out   []string
+		nodes = []*node{t.root}
+	)
+	for len(nodes) > 0 {
+		nd := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+
+		d := Distance(word, nd.word)
+		if d <= n {
+			out = append(out, nd.word)
+		}
+		// by the triangle inequality, only children at a distance of d-n to d+n from nd can be close enough
+		for cd, child := range nd.children {
+			if cd >= d-n && cd <= d+n {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Len returns the number of strings in the tree.
+func (t *Tree) Len() int {
+	return t.size
+}
+
+// Distance returns the Damerau-Levenshtein distance between a and b: the least number of characters inserted,
+// deleted or substituted, or of adjacent characters transposed, to turn a into b.
+// Unlike the optimal string alignment distance, a substring may be edited more than once, which makes it a metric.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return len(ra) + len(rb)
+	}
+
+	// d[i+1][j+1] is the distance between ra[:i] and rb[:j]; the extra row and column bound transpositions
+	// at the start of either string
+	inf := len(ra) + len(rb)
+	d := make([][]int, len(ra)+2)
+	for i := range d {
+		d[i] = make([]int, len(rb)+2)
+		d[i][0] = inf
+		if i > 0 {
+			d[i][1] = i - 1
+		}
+	}
+	for j := 1; j < len(rb)+2; j++ {
+		d[0][j] = inf
+		d[1][j] = j - 1
+	}
+
+	last := map[rune]int{} // last row in which each character of a was seen
+	for i := 1; i <= len(ra); i++ {
+		lastCol := 0 // last column in this row where the characters matched
+		for j := 1; j <= len(rb); j++ {
+			k, l := last[rb[j-1]], lastCol
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost, lastCol = 0, j
+			}
+			d[i+1][j+1] = least(
+				d[i][j]+cost,              // substitution
+				d[i+1][j]+1,               // insertion
+				d[i][j+1]+1,               // deletion
+				d[k][l]+(i-k-1)+1+(j-l-1), // transposition
+			)
+		}
+		last[ra[i-1]] = i
+	}
+	return d[len(ra)+1][len(rb)+1]
+}
+
+func least(n int, ns ...int) int {
+	for _, m := range ns {
+		if m < n {
+			n = m
+		}
+	}
+	return n
+}
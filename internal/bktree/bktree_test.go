@@ -0,0 +1,115 @@
+package bktree
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const iters = 200
+
+func TestDistance(t *testing.T) {
+	entries := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "", b: "", expected: 0},
+		{a: "", b: "abc", expected: 3},
+		{a: "colour", b: "colour", expected: 0},
+		{a: "colour", b: "color", expected: 1},
+		{a: "colour", b: "Colour", expected: 1},
+		{a: "recieve", b: "receive", expected: 1},
+		{a: "kitten", b: "sitting", expected: 3},
+		{a: "ca", b: "abc", expected: 2}, // 3 if a substring could only be edited once
+		{a: "café", b: "cafe", expected: 1},
+		{a: "東京", b: "京東", expected: 1},
+	}
+	for i, entry := range entries {
+		if d := Distance(entry.a, entry.b); d != entry.expected {
+			t.Errorf("test #%d should have distance=%d, but distance=%d", i+1, entry.expected, d)
+		}
+		if d := Distance(entry.b, entry.a); d != entry.expected {
+			t.Errorf("test #%d should be symmetric, but distance=%d", i+1, d)
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	t.Run("test empty tree", func(t *testing.T) {
+		tree := New()
+
+		if tree.Len() != 0 || tree.Search("foo", 2) != nil {
+			t.Error("empty tree should have no strings")
+		}
+
+		if !tree.Add("foo") {
+			t.Error("tree.Add must return true if no duplicate present")
+		}
+		if tree.Add("foo") {
+			t.Error("tree.Add must return false if duplicate present")
+		}
+		if tree.Len() != 1 {
+			t.Errorf("len of tree was not 1, but %d", tree.Len())
+		}
+	})
+
+	t.Run("test search", func(t *testing.T) {
+		tree := New("colour", "color", "colours", "collar", "dolor", "cool")
+
+		entries := []struct {
+			word     string
+			n        int
+			expected []string
+		}{
+			{word: "colour", n: 0, expected: []string{"colour"}},
+			{word: "colour", n: 1, expected: []string{"color", "colour", "colours"}},
+			{word: "color", n: 2, expected: []string{"collar", "color", "colour", "colours", "cool", "dolor"}},
+			{word: "xyz", n: 1, expected: nil},
+			{word: "colour", n: -1, expected: nil},
+		}
+		for i, entry := range entries {
+			if words := tree.Search(entry.word, entry.n); !reflect.DeepEqual(words, entry.expected) {
+				t.Errorf("test #%d should have words=%q, but words=%q", i+1, entry.expected, words)
+			}
+		}
+	})
+
+	t.Run("test search against linear scan", func(t *testing.T) {
+		const letters = "abcd"
+		randWord := func() string {
+			b := make([]byte, 1+rand.Intn(6))
+			for i := range b {
+				b[i] = letters[rand.Intn(len(letters))]
+			}
+			return string(b)
+		}
+
+		tree := New()
+		words := map[string]bool{}
+		for i := 0; i < iters; i++ {
+			w := randWord()
+			if tree.Add(w) == words[w] {
+				t.Fatalf("tree.Add(%q) should have returned %v", w, !words[w])
+			}
+			words[w] = true
+		}
+		if tree.Len() != len(words) {
+			t.Fatalf("len of tree was not %d, but %d", len(words), tree.Len())
+		}
+
+		for i := 0; i < iters; i++ {
+			word, n := randWord(), rand.Intn(3)
+			var expected []string
+			for w := range words {
+				if Distance(word, w) <= n {
+					expected = append(expected, w)
+				}
+			}
+			sort.Strings(expected)
+			if found := tree.Search(word, n); !reflect.DeepEqual(found, expected) {
+				t.Errorf("search for %q within %d should have found %q, but found %q", word, n, expected, found)
+			}
+		}
+	})
+}
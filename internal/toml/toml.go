@@ -0,0 +1,414 @@
+// Package toml parses the subset of TOML used by rule files.
+//
+// Supported are comments, key/value pairs, tables ([name]) and arrays of tables ([[name]]) with bare keys,
+// and values that are strings of any of the four kinds, decimal integers, booleans, or arrays of those,
+// which may span several lines. Not supported are quoted and dotted keys, inline tables, floats and dates.
+package toml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Table is a table of key/value pairs.
+//
+// Values are string, int64, bool, []interface{} for arrays, *Table for tables and []*Table for arrays of tables.
+type Table struct {
+	Line   int // line the table starts on, starting from 1; 0 for the root table
+	Values map[string]interface{}
+}
+
+// Error is a syntax error in a document.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("toml: line %d: %s", e.Line, e.Msg)
+}
+
+func newTable(line int) *Table {
+	return &Table{Line: line, Values: map[string]interface{}{}}
+}
+
+// parser reads a document, tracking the line it is on.
+type parser struct {
+	s    string
+	i    int // offset of the next byte to read
+	line int // line of the next byte to read, starting from 1
+}
+
+// Parse parses a document into its root table.
+func Parse(data []byte) (*Table, error) {
+	var (
+		p       = &parser{s: string(data), line: 1}
+		root    = newTable(0)
+		current = root
+		err     error
+	)
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return root, nil
+		}
+
+		switch p.peek() {
+		case '\n':
+			p.next()
+			continue
+		case '#':
+			p.skipComment()
+			continue
+		case '[':
+			current, err = p.header(root)
+		default:
+			err = p.keyValue(current)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	return p.s[p.i]
+}
+
+// next reads a byte.
+func (p *parser) next() byte {
+	c := p.s[p.i]
+	p.i++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// restOfLine returns what is left of the current line, without its newline.
+func (p *parser) restOfLine() string {
+	rest := p.s[p.i:]
+	if end := strings.IndexByte(rest, '\n'); end >= 0 {
+		rest = rest[:end]
+	}
+	return strings.TrimSuffix(rest, "\r")
+}
+
+func (p *parser) errorf(line int, format string, args ...interface{}) *Error {
+	return &Error{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skipSpace skips whitespace other than newlines.
+func (p *parser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r') {
+		p.next()
+	}
+}
+
+// skipComment skips a comment up to the end of its line.
+func (p *parser) skipComment() {
+	for !p.eof() && p.peek() != '\n' {
+		p.next()
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments, which may occur between the values of an array.
+func (p *parser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.next()
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+// endLine checks that nothing but a comment follows on the current line.
+func (p *parser) endLine() error {
+	p.skipSpace()
+	if !p.eof() && p.peek() == '#' {
+		p.skipComment()
+	}
+	if !p.eof() && p.peek() != '\n' {
+		return p.errorf(p.line, "unexpected %q after value", p.restOfLine())
+	}
+	return nil
+}
+
+// header reads a table or array of tables header, and returns the table it starts.
+func (p *parser) header(root *Table) (*Table, error) {
+	var (
+		line  = p.line
+		array = strings.HasPrefix(p.s[p.i:], "[[")
+		what  = "table header"
+		open  = "["
+	)
+	if array {
+		what, open = "array of tables header", "[["
+	}
+	p.i += len(open)
+
+	rest := p.restOfLine()
+	end := strings.Index(rest, strings.Repeat("]", len(open)))
+	if end < 0 {
+		return nil, p.errorf(line, "unterminated %s", what)
+	}
+	key := strings.TrimSpace(rest[:end])
+	p.i += end + len(open)
+	if !isBareKey(key) {
+		return nil, p.errorf(line, "invalid key %q", key)
+	}
+
+	t := newTable(line)
+	existing, exists := root.Values[key]
+	if !array {
+		if exists {
+			return nil, p.errorf(line, "key %q is already defined", key)
+		}
+		root.Values[key] = t
+		return t, nil
+	}
+	tables, ok := existing.([]*Table)
+	if exists && !ok {
+		return nil, p.errorf(line, "key %q is already defined", key)
+	}
+	root.Values[key] = append(tables, t)
+	return t, nil
+}
+
+// keyValue reads a key/value pair into t.
+func (p *parser) keyValue(t *Table) error {
+	line := p.line
+	rest := p.restOfLine()
+	eq := strings.IndexByte(rest, '=')
+	if eq < 0 {
+		return p.errorf(line, "expected key = value")
+	}
+	key := strings.TrimSpace(rest[:eq])
+	if !isBareKey(key) {
+		return p.errorf(line, "invalid key %q", key)
+	}
+	if _, exists := t.Values[key]; exists {
+		return p.errorf(line, "key %q is already defined", key)
+	}
+	p.i += eq + 1
+	p.skipSpace()
+
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	t.Values[key] = v
+	return nil
+}
+
+// isBareKey returns whether s is a valid bare key.
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// value reads a value.
+func (p *parser) value() (interface{}, error) {
+	if p.eof() || p.peek() == '\n' || p.peek() == '#' {
+		return nil, p.errorf(p.line, "missing value")
+	}
+
+	switch rest := p.s[p.i:]; {
+	case strings.HasPrefix(rest, `"""`), strings.HasPrefix(rest, "'''"):
+		return p.multiLineString()
+	case rest[0] == '"':
+		return p.basicString()
+	case rest[0] == '\'':
+		line := p.line
+		end := strings.IndexAny(rest[1:], "'\n")
+		if end < 0 || rest[1+end] != '\'' {
+			return nil, p.errorf(line, "unterminated string")
+		}
+		p.i += end + 2
+		return rest[1 : end+1], nil
+	case rest[0] == '[':
+		return p.array()
+	}
+
+	word := p.s[p.i:]
+	if end := strings.IndexAny(word, ", ]\t\r\n#"); end >= 0 {
+		word = word[:end]
+	}
+	p.i += len(word)
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	v, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 10, 64)
+	if err != nil {
+		return nil, p.errorf(p.line, "invalid value %q", word)
+	}
+	return v, nil
+}
+
+// basicString reads a string in double quotes on a single line.
+func (p *parser) basicString() (string, error) {
+	line := p.line
+	p.next()
+
+	var b strings.Builder
+	for !p.eof() && p.peek() != '\n' {
+		switch c := p.next(); c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf(line, "unterminated string")
+}
+
+// multiLineString reads a string in triple double or single quotes, which may span several lines.
+// A newline immediately after the opening quotes is not part of the string.
+// In a basic string, a backslash at the end of a line removes the newline and any whitespace that follows it.
+func (p *parser) multiLineString() (string, error) {
+	var (
+		line  = p.line
+		delim = p.s[p.i : p.i+3]
+		b     strings.Builder
+	)
+	p.i += 3
+	if strings.HasPrefix(p.s[p.i:], "\r\n") {
+		p.i++
+	}
+	if !p.eof() && p.peek() == '\n' {
+		p.next()
+	}
+
+	for !p.eof() {
+		if strings.HasPrefix(p.s[p.i:], delim) {
+			// up to two quotes may be part of the string just before the closing quotes
+			end := 3
+			for end < 5 && p.i+end < len(p.s) && p.s[p.i+end] == delim[0] {
+				end++
+			}
+			b.WriteString(p.s[p.i : p.i+end-3])
+			p.i += end
+			return b.String(), nil
+		}
+
+		c := p.next()
+		if c != '\\' || delim[0] == '\'' {
+			b.WriteByte(c)
+			continue
+		}
+		if strings.TrimLeft(p.restOfLine(), " \t") == "" {
+			for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+				p.next()
+			}
+			continue
+		}
+		if err := p.escape(&b); err != nil {
+			return "", err
+		}
+	}
+	return "", p.errorf(line, "unterminated string")
+}
+
+// escape reads an escape sequence after a backslash in a basic string, and writes the character it stands for to b.
+func (p *parser) escape(b *strings.Builder) error {
+	if p.eof() || p.peek() == '\n' {
+		return p.errorf(p.line, "unterminated escape sequence")
+	}
+
+	c := p.next()
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.i+size > len(p.s) {
+			return p.errorf(p.line, "invalid escape sequence \\%c", c)
+		}
+		hex := p.s[p.i : p.i+size]
+		r, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || strings.ContainsAny(hex, "+-") || !utf8.ValidRune(rune(r)) {
+			return p.errorf(p.line, "invalid escape sequence \\%c%s", c, hex)
+		}
+		p.i += size
+		b.WriteRune(rune(r))
+	default:
+		return p.errorf(p.line, "invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+// array reads an array, whose values may be separated by newlines and comments, and may end with a comma.
+func (p *parser) array() ([]interface{}, error) {
+	var (
+		line = p.line
+		arr  = []interface{}{}
+	)
+	p.next()
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, p.errorf(line, "unterminated array")
+		}
+		if p.peek() == ']' {
+			p.next()
+			return arr, nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+
+		p.skipBlank()
+		switch {
+		case p.eof():
+			return nil, p.errorf(line, "unterminated array")
+		case p.peek() == ',':
+			p.next()
+		case p.peek() != ']':
+			return nil, p.errorf(p.line, "expected ',' or ']' in array")
+		}
+	}
+}
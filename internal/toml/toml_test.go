@@ -0,0 +1,106 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc := `
+# rules for the farm
+title = "farm" # trailing comment
+version = 2
+
+[[rules]]
+id = "lunar-cow"
+expr = "moon+cow"
+tags = ["space", 'animals', "#1"]
+enabled = true
+
+[[rules]]
+id = 'escaped'
+expr = "\"farmers market\"\t"
+tags = []
+enabled = false
+
+[owner]
+name = "pixeltopic"
+aliases = [
+  "pixel", # the short one
+  'topic',
+]
+bio = """
+Runs the "farm".é \
+    Grows moons."""
+motto = '''
+no \escapes'''
+`
+
+	root, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("should have err=nil, but err=%v", err)
+	}
+
+	expected := &Table{
+		Values: map[string]interface{}{
+			"title":   "farm",
+			"version": int64(2),
+			"rules": []*Table{
+				{Line: 6, Values: map[string]interface{}{
+					"id":      "lunar-cow",
+					"expr":    "moon+cow",
+					"tags":    []interface{}{"space", "animals", "#1"},
+					"enabled": true,
+				}},
+				{Line: 12, Values: map[string]interface{}{
+					"id":      "escaped",
+					"expr":    "\"farmers market\"\t",
+					"tags":    []interface{}{},
+					"enabled": false,
+				}},
+			},
+			"owner": &Table{Line: 18, Values: map[string]interface{}{
+				"name":    "pixeltopic",
+				"aliases": []interface{}{"pixel", "topic"},
+				"bio":     "Runs the \"farm\".é Grows moons.",
+				"motto":   "no \\escapes",
+			}},
+		},
+	}
+	if !reflect.DeepEqual(root, expected) {
+		t.Errorf("should have parsed %#v, but parsed %#v", expected, root)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	entries := []struct {
+		in   string
+		line int
+	}{
+		{in: "id", line: 1},
+		{in: "\n\nid = \"cow", line: 3},
+		{in: "id = 'cow", line: 1},
+		{in: "id = cow", line: 1},
+		{in: "id = \"cow\" moon", line: 1},
+		{in: "id = 1\nid = 2", line: 2},
+		{in: "[[rules]\nid = 1", line: 1},
+		{in: "[rules\nid = 1", line: 1},
+		{in: "[rules]\n[[rules]]", line: 2},
+		{in: "tags = [\"a\" \"b\"]", line: 1},
+		{in: "tags = [\"a\",", line: 1},
+		{in: "my key = 1", line: 1},
+		{in: "id =", line: 1},
+		{in: `id = "\x41"`, line: 1},
+		{in: `id = "\uD800"`, line: 1},
+		{in: "tags = [\n\"a\",\n\"b\"\n", line: 1},
+		{in: "tags = [\n\"a\"\n\"b\"]", line: 3},
+		{in: "desc = \"\"\"\nmoon", line: 1},
+		{in: "desc = '''moon\n\ncow''", line: 1},
+	}
+	for i, entry := range entries {
+		_, err := Parse([]byte(entry.in))
+		if perr, ok := err.(*Error); !ok || perr.Line != entry.line {
+			t.Errorf("test #%d should have failed on line %d, but err=%v", i+1, entry.line, err)
+		}
+	}
+}
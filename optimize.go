@@ -0,0 +1,132 @@
+package rematch
+
+import (
+	"sort"
+)
+
+// Optimize simplifies the expression when it is compiled, so that it is cheaper to evaluate:
+//
+//   - nested AND and OR operators of the same kind are flattened, so (a+b)+c and a+(b+c) become a+b+c
+//   - double negations are removed, so !!a becomes a
+//   - duplicate operands of an AND or OR operator are removed, so a|a becomes a
+//   - operands of an AND or OR operator are reordered so that words and phrases, which are looked up in the
+//     words of a text, come before patterns, which are matched against its entire raw string
+//
+// An optimized expression matches exactly the same texts as the original. Result.Strings and Result.Spans are also
+// the same, with one exception: a word, phrase or pattern that occurs more than once in a chain of AND operators, or in a
+// chain of OR operators, contributes its matches once rather than once per occurrence, so Result.Strings has fewer duplicates.
+//
+// Expr.RPN and Format return the optimized expression.
+func Optimize() ExprOption {
+	return func(e *Expr) {
+		e.optimize = true
+	}
+}
+
+// optimize returns an optimized copy of a tree, as described by Optimize.
+func optimize(n Node) Node {
+	switch n := n.(type) {
+	case *AndNode:
+		return optimizeInfix(n, n.Nodes)
+	case *OrNode:
+		return optimizeInfix(n, n.Nodes)
+	case *NotNode:
+		if inner, ok := n.Node.(*NotNode); ok {
+			return optimize(inner.Node)
+		}
+		return &NotNode{Node: optimize(n.Node)}
+	}
+	return cloneNode(n)
+}
+
+// optimizeInfix returns an optimized copy of the AND or OR operator n with operands nodes.
+func optimizeInfix(n Node, nodes []Node) Node {
+	var (
+		operands []Node
+		seen     = map[string]bool{}
+	)
+
+	var add func(c Node)
+	add = func(c Node) {
+		if sameOp(n, c) {
+			for _, cc := range infixNodes(c) {
+				add(cc)
+			}
+			return
+		}
+		if key := formatNode(c); !seen[key] {
+			seen[key] = true
+			operands = append(operands, c)
+		}
+	}
+	for _, c := range nodes {
+		add(optimize(c))
+	}
+
+	sort.SliceStable(operands, func(i, j int) bool {
+		return cost(operands[i]) < cost(operands[j])
+	})
+
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	if isAnd(n) {
+		return &AndNode{Nodes: operands}
+	}
+	return &OrNode{Nodes: operands}
+}
+
+// isAnd returns whether n is an AND operator.
+func isAnd(n Node) bool {
+	_, ok := n.(*AndNode)
+	return ok
+}
+
+// infixNodes returns the operands of an AND or OR operator.
+func infixNodes(n Node) []Node {
+	switch n := n.(type) {
+	case *AndNode:
+		return n.Nodes
+	case *OrNode:
+		return n.Nodes
+	}
+	return nil
+}
+
+// cost estimates the relative cost of evaluating a tree.
+func cost(n Node) int {
+	// patterns are matched against the entire raw string of a text, which is far more expensive than a word lookup.
+	// A fuzzy word is compared to some of the unique words of a text, which is cheaper than a pattern.
+	const (
+		patternCost = 100
+		fuzzyCost   = 10
+	)
+
+	switch n := n.(type) {
+	case *AndNode:
+		return costSum(n.Nodes)
+	case *OrNode:
+		return costSum(n.Nodes)
+	case *NotNode:
+		return cost(n.Node)
+	case *NearNode:
+		return cost(n.Left) + cost(n.Right) + 1
+	case *PhraseNode:
+		return len(n.Words)
+	case *PatternNode:
+		return patternCost
+	case *WordNode:
+		if n.Edits > 0 {
+			return fuzzyCost
+		}
+	}
+	return 1
+}
+
+func costSum(nodes []Node) int {
+	var sum int
+	for _, n := range nodes {
+		sum += cost(n)
+	}
+	return sum
+}
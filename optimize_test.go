@@ -0,0 +1,76 @@
+package rematch
+
+import (
+	"testing"
+)
+
+// testOptimizeEntry optimizes an expression and compares its canonical form.
+type testOptimizeEntry struct {
+	in  string
+	out string
+}
+
+func TestOptimize(t *testing.T) {
+	texts := []string{
+		"The cow jumped over the moon",
+		"the jolly farmer at the farmers market",
+		"moonshine and cows",
+		"",
+	}
+
+	entries := []testOptimizeEntry{
+		{in: "cow", out: "cow"},
+		{in: "(cow+moon)+(over+the)", out: "cow+moon+over+the"},
+		{in: "cow|(moon|(over|the))", out: "cow|moon|over|the"},
+		{in: "cow+(moon|over)+the", out: "cow+the+(moon|over)"},
+		{in: "!!cow", out: "cow"},
+		{in: "!!!cow", out: "!cow"},
+		{in: "!(!(cow+moon)+!!jolly)", out: "!(jolly+!(cow+moon))"},
+		{in: "cow|cow", out: "cow"},
+		{in: "(cow+moon)|(moon+cow)", out: "(cow+moon)|(moon+cow)"},
+		{in: "cow+moon+cow", out: "cow+moon"},
+		{in: "moon*+cow", out: "cow+moon*"},
+		{in: "moon*|(jump*+cow)|the", out: "the|moon*|(cow+jump*)"},
+		{in: `farm*+"farmers market"+cow~2~moon`, out: `"farmers market"+cow~2~moon+farm*`},
+		{in: "(!!cow|cow)+cow*", out: "cow+cow*"},
+		{in: "moon*+colour~1+cow", out: "cow+colour~1+moon*"},
+	}
+
+	for i, entry := range entries {
+		expr := NewExpr(entry.in, Optimize())
+		out, err := Format(expr)
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if out != entry.out {
+			t.Errorf("test #%d should have out=%s, but out=%s", i+1, entry.out, out)
+		}
+
+		// the optimized expression must have the same results, except for duplicate strings
+		for j, text := range texts {
+			expected, _ := RawExprFindAll(entry.in, text)
+			res, err := ExprFindAll(expr, text)
+			if err != nil {
+				t.Errorf("test #%d:%d should have err=nil, but err=%v", i+1, j+1, err)
+			} else if res.Match != expected.Match {
+				t.Errorf("test #%d:%d should have res=%v, but res=%v", i+1, j+1, expected.Match, res.Match)
+			} else if !testUnorderedSliceEq(testUnique(res.Strings), testUnique(expected.Strings)) {
+				t.Errorf("test #%d:%d should have res=%v, but res=%v", i+1, j+1, expected.Strings, res.Strings)
+			}
+		}
+	}
+}
+
+// testUnique returns the distinct strings of s.
+func testUnique(s []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, str := range s {
+		if !seen[str] {
+			seen[str] = true
+			out = append(out, str)
+		}
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+package rematch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry holds the rules of every rule file in a directory (see LoadRules), and reloads them when the files change.
+//
+// The rules of every file are combined into a single RuleSet, which is replaced as a whole when a file changes.
+// Match and FindAll always use one version of the rules, so they are safe to call while the rules are reloaded.
+type Registry struct {
+	dir   string
+	opts  []ExprOption
+	rules atomic.Value // *RuleSet combining the last good version of every file
+
+	mu    sync.Mutex               // guards files and serializes reloads
+	files map[string]*registryFile // files loaded so far, by name in dir
+}
+
+// registryFile is a rule file loaded by a Registry.
+type registryFile struct {
+	modTime time.Time
+	size    int64
+	rules   *RuleSet // last version of the file without any invalid rules; nil if there has been none
+}
+
+// NewRegistry returns a Registry of the rule files in dir, whose expressions are compiled with opts.
+// It has no rules until Reload is called.
+func NewRegistry(dir string, opts ...ExprOption) *Registry {
+	r := &Registry{dir: dir, opts: opts, files: map[string]*registryFile{}}
+	r.rules.Store(NewRuleSet())
+	return r
+}
+
+// Rules returns the current version of the rules. It is not affected by later reloads.
+func (r *Registry) Rules() *RuleSet {
+	return r.rules.Load().(*RuleSet)
+}
+
+// Match returns the IDs of every rule that matches text, like RuleSet.Match for the current version of the rules.
+func (r *Registry) Match(text *Text) ([]string, error) {
+	return r.Rules().Match(text)
+}
+
+// FindAll returns the result of every rule that matches text, like RuleSet.FindAll for the current version of the rules.
+func (r *Registry) FindAll(text *Text) (map[string]*Result, error) {
+	return r.Rules().FindAll(text)
+}
+
+// Reload loads every rule file in the directory that was added or modified since the last reload,
+// and replaces the rules if any file was added, modified or removed. A file is considered modified if its
+// modification time or size changed.
+//
+// A file with an invalid rule keeps its last good version, if any, and the problem is returned rather than
+// applied; a modified file is only reported once. Every problem is returned, ordered by file name.
+func (r *Registry) Reload() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return []error{fmt.Errorf("rematch: %w", err)}
+	}
+
+	var (
+		errs     []error
+		changed  bool
+		found    = map[string]bool{}
+		modified = map[string]bool{} // files loaded without any invalid rule
+	)
+	for _, info := range infos {
+		name := info.Name()
+		if _, ok := ruleFormats[strings.ToLower(filepath.Ext(name))]; !ok || info.IsDir() {
+			continue
+		}
+		found[name] = true
+
+		f := r.files[name]
+		if f != nil && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+			continue
+		}
+		if f == nil {
+			f = &registryFile{}
+			r.files[name] = f
+		}
+		f.modTime, f.size = info.ModTime(), info.Size()
+
+		rs, err := LoadRules(filepath.Join(r.dir, name), r.opts...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		f.rules = rs
+		changed = true
+		modified[name] = true
+	}
+	for name := range r.files {
+		if !found[name] {
+			delete(r.files, name)
+			changed = true
+		}
+	}
+
+	if changed {
+		errs = append(errs, r.combine(modified)...)
+	}
+	return errs
+}
+
+// combine replaces the rules with the last good version of every file.
+// A rule whose ID is already used by a file earlier in name order is left out. It is only reported if either file
+// is modified, so that it is reported once.
+func (r *Registry) combine(modified map[string]bool) []error {
+	names := make([]string, 0, len(r.files))
+	for name, f := range r.files {
+		if f.rules != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var (
+		rs     = NewRuleSet()
+		owners = map[string]string{} // file of each rule, by ID
+		errs   []error
+	)
+	for _, name := range names {
+		// the expressions were compiled when the file was loaded, so they are only indexed again
+		for i, rule := range r.files[name].rules.rules {
+			if err := rs.add(rule.meta, rule.expr); err == nil {
+				owners[rule.id] = name
+			} else if modified[name] || modified[owners[rule.id]] {
+				err = &RuleError{ID: rule.id, Index: i, Line: rule.meta.Line, Err: errors.New("duplicate ID")}
+				errs = append(errs, fmt.Errorf("%s: %w", filepath.Join(r.dir, name), err))
+			}
+		}
+	}
+	r.rules.Store(rs)
+	return errs
+}
+
+// Watch reloads the rules every interval until ctx is done. Each problem returned by Reload is passed to report,
+// which may be nil. Call Reload first to load the rules without waiting for the first interval.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration, report func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, err := range r.Reload() {
+				if report != nil {
+					report(err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package rematch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWriteRules writes a rule file and sets its modification time to mod, so a change is detected regardless of
+// the resolution of the file system.
+func testWriteRules(t *testing.T, path, data string, mod time.Time) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rematch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		cow   = filepath.Join(dir, "cow.toml")
+		moon  = filepath.Join(dir, "moon.json")
+		mod   = time.Now().Add(-time.Hour)
+		text  = NewText("the cow jumped over the moon")
+		match = func(reg *Registry) []string {
+			ids, _ := reg.Match(text)
+			return ids
+		}
+	)
+	testWriteRules(t, cow, "[[rules]]\nid = \"cow\"\nexpr = \"cow\"", mod)
+	testWriteRules(t, moon, `{"rules": [{"id": "moon", "expr": "moon"}]}`, mod)
+	testWriteRules(t, filepath.Join(dir, "notes.txt"), "not a rule file", mod)
+
+	reg := NewRegistry(dir, IgnoreCase())
+	if ids := match(reg); len(ids) != 0 {
+		t.Errorf("should have no rules before reloading, but matched %v", ids)
+	}
+
+	steps := []struct {
+		change func()
+		ids    []string
+		errs   int
+	}{
+		{change: func() {}, ids: []string{"cow", "moon"}},
+		{change: func() {}, ids: []string{"cow", "moon"}},
+		{
+			// a modified file replaces its rules
+			change: func() {
+				testWriteRules(t, cow, "[[rules]]\nid = \"cow\"\nexpr = \"COW+!moon\"", mod.Add(time.Second))
+			},
+			ids: []string{"moon"},
+		},
+		{
+			// a file with an invalid rule keeps its last good version, and is only reported once
+			change: func() {
+				testWriteRules(t, cow, "[[rules]]\nid = \"cow\"\nexpr = \"cow+\"", mod.Add(2*time.Second))
+			},
+			ids:  []string{"moon"},
+			errs: 1,
+		},
+		{change: func() {}, ids: []string{"moon"}},
+		{
+			// a rule ID used by an earlier file is left out
+			change: func() {
+				testWriteRules(t, moon, `{"rules": [{"id": "cow", "expr": "moon"}, {"id": "jump", "expr": "jump*"}]}`, mod.Add(time.Second))
+			},
+			ids:  []string{"jump"},
+			errs: 1,
+		},
+		{
+			// and is not reported again when another file is modified
+			change: func() {
+				testWriteRules(t, filepath.Join(dir, "spoon.json"), `{"rules": [{"id": "spoon", "expr": "spoon"}]}`, mod)
+			},
+			ids: []string{"jump"},
+		},
+		{
+			change: func() {
+				if err := os.Remove(cow); err != nil {
+					t.Fatal(err)
+				}
+			},
+			ids: []string{"cow", "jump"},
+		},
+	}
+	for i, step := range steps {
+		step.change()
+		if errs := reg.Reload(); len(errs) != step.errs {
+			t.Errorf("step #%d should have %d errors, but errs=%v", i+1, step.errs, errs)
+		}
+		if ids := match(reg); !reflect.DeepEqual(ids, step.ids) {
+			t.Errorf("step #%d should have matched %v, but matched %v", i+1, step.ids, ids)
+		}
+	}
+
+	reg = NewRegistry(filepath.Join(dir, "missing"))
+	if errs := reg.Reload(); len(errs) != 1 {
+		t.Errorf("should have failed to read a missing directory, but errs=%v", errs)
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rematch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		path     = filepath.Join(dir, "rules.json")
+		mod      = time.Now().Add(-time.Hour)
+		versions = []string{
+			`{"rules": [{"id": "a1", "expr": "cow"}, {"id": "b1", "expr": "moon"}]}`,
+			`{"rules": [{"id": "a2", "expr": "cow"}, {"id": "b2", "expr": "moon"}]}`,
+		}
+	)
+	testWriteRules(t, path, versions[0], mod)
+
+	reg := NewRegistry(dir)
+	if errs := reg.Reload(); len(errs) != 0 {
+		t.Fatalf("should have errs=nil, but errs=%v", errs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Watch(ctx, time.Millisecond, func(err error) {
+		t.Errorf("should not have reported err=%v", err)
+	})
+
+	var (
+		wg   sync.WaitGroup
+		text = NewText("the cow jumped over the moon")
+		done = make(chan struct{})
+	)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// every rule of a version is matched together, so a mix of versions would be seen here
+				ids, _ := reg.Match(text)
+				if !reflect.DeepEqual(ids, []string{"a1", "b1"}) && !reflect.DeepEqual(ids, []string{"a2", "b2"}) {
+					t.Errorf("should have matched one version of the rules, but matched %v", ids)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 21; i++ {
+		// files are replaced by renaming, so a partly written file is never read
+		testWriteRules(t, path+".tmp", versions[i%2], mod.Add(time.Duration(i)*time.Second))
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// the last version written is eventually loaded
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := reg.Rules().Rule("a2"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("should have reloaded the last version of the rules")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(done)
+	wg.Wait()
+}
@@ -1,58 +1,296 @@
 package rematch
 
 import (
+	"sort"
 	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 
-	"github.com/pixeltopic/rematch/internal/set"
+	"github.com/pixeltopic/rematch/internal/bktree"
 )
 
 // replaceNonAlphaNum removes all non-alphanumeric characters, replacing them with spaces.
+// A replaced character is substituted with one space per byte so byte offsets into s are preserved.
 // Strings are immutable, so this returns a new string.
 func replaceNonAlphaNum(s string) string {
 	var result strings.Builder
-	for i := 0; i < len(s); i++ {
-		b := s[i]
-		if b == ' ' || isAlphaNum(string(b)) {
-			result.WriteByte(b)
-		} else {
-			result.WriteString(" ")
+	result.Grow(len(s))
+	for i, r := range s {
+		if isAlphaNum(r) {
+			result.WriteRune(r)
+			continue
 		}
+		// invalid UTF-8 decodes to a single byte, so the width is taken from the position of the next rune
+		width := utf8.RuneLen(r)
+		if r == utf8.RuneError {
+			_, width = utf8.DecodeRuneInString(s[i:])
+		}
+		result.WriteString(strings.Repeat(" ", width))
 	}
 	return result.String()
 }
 
-// isAlphaNum returns whether a string is only alphanumeric or not. Whitespaces present will return false.
-func isAlphaNum(s string) bool {
-	for i := 0; i < len(s); i++ {
-		b := s[i]
-		if ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') {
-		} else {
-			return false
+// isAlphaNum returns whether a rune is a Unicode letter, digit or combining mark.
+// Marks are included so words written in decomposed form (such as "e" followed by U+0301) are not split.
+func isAlphaNum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// wordFields splits s into alphanumeric word tokens, recording the byte offsets of each token in s.
+func wordFields(s string) []textToken {
+	var (
+		toks     []textToken
+		replaced = replaceNonAlphaNum(s) // byte offsets are preserved
+		start    = -1
+	)
+	for i := 0; i <= len(replaced); i++ {
+		if i < len(replaced) && replaced[i] != ' ' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			toks = append(toks, textToken{str: replaced[start:i], start: start, end: i})
+			start = -1
 		}
 	}
-	return true
+	return toks
+}
+
+// textToken is a word token in a Text along with its byte offsets in the raw string.
+type textToken struct {
+	str        string
+	start, end int
 }
 
 // Text contains text to match against an Expression.
-// This may be helpful if you want to match many different expressions against the same block of text without reprocessing it
+// This may be helpful if you want to match many different expressions against the same block of text without reprocessing it.
+// A Text is safe for concurrent use by multiple goroutines.
 type Text struct {
-	raw        string
-	uniqueToks set.Set
-	// contains case-sensitive words tokenized from raw. Non-alphanumeric chars are replaced with whitespace.
-	// word tokens are delimited by whitespace ("word boundaries")
+	raw       string
+	toks      []textToken      // word tokens of raw in order of appearance; used to match phrases and locate words
+	positions map[string][]int // ascending positions in toks of each unique, case-sensitive word; used for exact lookups
+
+	foldOnce  sync.Once
+	foldedPos map[string][]int // positions keyed by case-folded word; built on first case-insensitive lookup
+
+	fuzzyOnce, foldFuzzyOnce   sync.Once
+	fuzzyWords, foldFuzzyWords *bktree.Tree // unique words and case-folded words; built on first fuzzy lookup
+
+	// if any deobfuscation option is set, raw is the deobfuscated form of orig, and lo and hi are the range of orig
+	// that each byte of raw came from
+	orig   string
+	lo, hi []int
+
+	confusables bool // words of an expression are folded like the text before they are looked up
+}
+
+// Raw returns the string the text was created from, after normalization by NormalizeText if any.
+// Byte offsets of a Span refer to this string.
+func (t *Text) Raw() string {
+	if t.lo != nil {
+		return t.orig
+	}
+	return t.raw
+}
+
+// rawOffset returns the offset in Raw of an offset in the string that is matched, which differs if it was deobfuscated.
+func (t *Text) rawOffset(i int) int {
+	switch {
+	case t.lo == nil:
+		return i
+	case i < len(t.lo):
+		return t.lo[i]
+	}
+	return len(t.orig)
+}
+
+// restore makes the spans and strings of an operand matched against a deobfuscated text refer to the text as it was
+// written. As they are for any text, a word is reported once for each distinct way it is written.
+func (t *Text) restore(tok token, m *operandMatch) *operandMatch {
+	if t.lo == nil || !m.ok {
+		return m
+	}
+	var (
+		out  = &operandMatch{ok: true, spans: make([]Span, len(m.spans))}
+		seen = map[string]bool{}
+	)
+	for i, span := range m.spans {
+		start, end := t.rawOffset(span.Start), t.rawOffset(span.End)
+		if span.End > span.Start {
+			end = t.hi[span.End-1] // the last byte matched may stand for several, such as a collapsed repetition
+		}
+		span.Start, span.End = start, end
+		out.spans[i] = span
+
+		s := t.orig[span.Start:span.End]
+		if !tok.Phrase && !tok.Regex {
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+		}
+		out.strs = append(out.strs, s)
+	}
+	return out
+}
+
+// foldCase returns the case-folded form of s used for case-insensitive comparisons.
+func foldCase(s string) string {
+	return strings.ToLower(s)
+}
+
+// word returns a word of an expression as it would appear in the text, which differs if the text folds confusables.
+func (t *Text) word(w string) string {
+	if t.confusables {
+		return foldWord(w)
+	}
+	return w
+}
+
+// lookup returns the ascending positions of a word in the text.
+// If fold is true, the word is compared case-insensitively.
+func (t *Text) lookup(word string, fold bool) []int {
+	word = t.word(word)
+	if !fold {
+		return t.positions[word]
+	}
+	return t.foldedPositions()[foldCase(word)]
+}
+
+// foldedPositions returns the ascending positions of each case-folded word in the text.
+func (t *Text) foldedPositions() map[string][]int {
+	t.foldOnce.Do(func() {
+		t.foldedPos = make(map[string][]int, len(t.positions))
+		for i, tok := range t.toks {
+			k := foldCase(tok.str)
+			t.foldedPos[k] = append(t.foldedPos[k], i)
+		}
+	})
+	return t.foldedPos
+}
+
+// lookupFuzzy returns the ascending positions of every word in the text within n edits of a word.
+// If fold is true, words are compared case-insensitively.
+func (t *Text) lookupFuzzy(word string, n int, fold bool) []int {
+	if n == 0 {
+		return t.lookup(word, fold)
+	}
+	word = t.word(word)
+
+	var (
+		positions map[string][]int
+		tree      *bktree.Tree
+	)
+	if fold {
+		positions, word = t.foldedPositions(), foldCase(word)
+		t.foldFuzzyOnce.Do(func() {
+			t.foldFuzzyWords = wordTree(positions)
+		})
+		tree = t.foldFuzzyWords
+	} else {
+		positions = t.positions
+		t.fuzzyOnce.Do(func() {
+			t.fuzzyWords = wordTree(positions)
+		})
+		tree = t.fuzzyWords
+	}
+
+	var out []int
+	for _, w := range tree.Search(word, n) {
+		out = append(out, positions[w]...)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// wordTree returns a tree of the words of positions, to find the words within an edit distance of another.
+func wordTree(positions map[string][]int) *bktree.Tree {
+	tree := bktree.New()
+	for w := range positions {
+		tree.Add(w)
+	}
+	return tree
+}
+
+// TextOption configures a Text.
+type TextOption func(*textConfig)
+
+// textConfig contains the options used to build a Text.
+type textConfig struct {
+	normalize func(string) string
+	window    int       // look-behind of a stream in bytes
+	tokenizer Tokenizer // splits the text into words; if nil, AlphaNumTokenizer
+
+	// deobfuscation stages
+	confusables bool
+	join        bool
+	leet        bool
+	collapse    bool
+}
+
+// deobfuscates returns whether any deobfuscation stage is enabled.
+func (c textConfig) deobfuscates() bool {
+	return c.confusables || c.join || c.leet || c.collapse
+}
+
+// NormalizeText transforms the string with f before it is tokenized and matched.
+// This is intended for Unicode normalization such as norm.NFC.String or norm.NFKC.String from golang.org/x/text/unicode/norm,
+// so that equivalent sequences of code points match the same words.
+// Expressions should be normalized the same way with NormalizeExpr.
+//
+// Spans of a Result refer to the normalized string, which is returned by Text.Raw.
+func NormalizeText(f func(string) string) TextOption {
+	return func(c *textConfig) {
+		c.normalize = f
+	}
 }
 
 // NewText returns a text instance to match against an Expression.
-func NewText(s string) *Text {
+func NewText(s string, opts ...TextOption) *Text {
+	var cfg textConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.normalize != nil {
+		s = cfg.normalize(s)
+	}
+	return newText(s, cfg)
+}
+
+// newText returns a text instance for s, which has already been normalized, applying any deobfuscation stages of cfg.
+func newText(s string, cfg textConfig) *Text {
+	var d deobfuscation
+	if cfg.deobfuscates() {
+		d = deobfuscate(s, cfg)
+		s, d.s = d.s, s
+	}
+
+	var (
+		toks      = tokenize(s, cfg.tokenizer)
+		positions = make(map[string][]int)
+	)
+	for i, tok := range toks {
+		positions[tok.str] = append(positions[tok.str], i)
+	}
 	return &Text{
-		raw:        s,
-		uniqueToks: set.NewStringSet(strings.Fields(replaceNonAlphaNum(s))...),
+		raw:       s,
+		toks:      toks,
+		positions: positions,
+		orig:      d.s,
+		lo:        d.lo,
+		hi:        d.hi,
+
+		confusables: cfg.confusables,
 	}
 }
 
-// EvalRawExpr matches a raw expression against a string
-func EvalRawExpr(expr, s string) (bool, error) {
-	return EvalExpr(NewExpr(expr), s)
+// EvalRawExpr matches a raw expression against a string.
+// A SyntaxError is returned if the expression is malformed.
+func EvalRawExpr(expr, s string, opts ...ExprOption) (bool, error) {
+	return EvalExpr(NewExpr(expr, opts...), s)
 }
 
 // EvalExpr matches an expression against a string.
@@ -60,18 +298,26 @@ func EvalExpr(expr *Expr, s string) (bool, error) {
 	return Eval(expr, NewText(s))
 }
 
-// Eval matches an expression against text
+// Eval matches an expression against text.
+// A SyntaxError is returned if the expression is malformed, or an EvalError if it could not be evaluated.
+// If the expression was created with Lenient, errors are discarded and the expression does not match.
+//
+// Evaluation stops as soon as the outcome is decided, so words, phrases and patterns that cannot change it
+// are never matched. Use FindAll for the strings and spans that matched.
 func Eval(expr *Expr, text *Text) (bool, error) {
-	res, err := FindAll(expr, text)
+	root, err := expr.compile()
 	if err != nil {
-		return false, nil
+		if expr.lenient {
+			return false, nil
+		}
+		return false, err
 	}
-	return res.Match, nil
+	return matchNode(root, text, nil), nil
 }
 
 // RawExprFindAll matches a raw expression against a string, returning all matched tokens if true
-func RawExprFindAll(expr, s string) (*Result, error) {
-	return ExprFindAll(NewExpr(expr), s)
+func RawExprFindAll(expr, s string, opts ...ExprOption) (*Result, error) {
+	return ExprFindAll(NewExpr(expr, opts...), s)
 }
 
 // ExprFindAll matches an expression against a string, returning all matched tokens if true
@@ -79,16 +325,12 @@ func ExprFindAll(expr *Expr, s string) (*Result, error) {
 	return FindAll(expr, NewText(s))
 }
 
-// FindAll matches an expression against text, returning all matched tokens if true
+// FindAll matches an expression against text, returning all matched tokens if true.
+// Every word, phrase and pattern in the expression is matched, even if it cannot change the outcome.
 func FindAll(expr *Expr, text *Text) (*Result, error) {
-	err := expr.Compile()
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := evalRPN(expr.rpn, text)
+	root, err := expr.compile()
 	if err != nil {
 		return nil, err
 	}
-	return res, err
+	return evalNode(root, text, nil), nil
 }
@@ -0,0 +1,44 @@
+package rematch
+
+import (
+	"errors"
+	"testing"
+)
+
+// testErrEntry evaluates a raw expression against text, expecting a given error.
+type testErrEntry struct {
+	in   string
+	text string
+	opts []ExprOption
+	err  error
+}
+
+func TestEvalErrors(t *testing.T) {
+	entries := []testErrEntry{
+		{in: "cow+moon", text: "the cow jumped over the moon"},
+		{in: "cow+", text: "the cow jumped over the moon", err: SyntaxError("unexpected operator at end of expression, want operand")},
+		{in: "cow moon", text: "the cow jumped over the moon", err: SyntaxError("invalid char in word; must be alphanumeric")},
+		{in: "cow+", text: "the cow jumped over the moon", opts: []ExprOption{Lenient()}},
+		{in: "cow moon", text: "the cow jumped over the moon", opts: []ExprOption{Lenient(), IgnoreCase()}},
+	}
+
+	for i, entry := range entries {
+		ok, err := EvalRawExpr(entry.in, entry.text, entry.opts...)
+		if !errors.Is(err, entry.err) {
+			t.Errorf("test #%d should have err=%v, but err=%v", i+1, entry.err, err)
+		}
+		if err != nil && ok {
+			t.Errorf("test #%d should not match when err=%v", i+1, err)
+		}
+
+		expr := NewExpr(entry.in, entry.opts...)
+		if _, err := Eval(expr, NewText(entry.text)); !errors.Is(err, entry.err) {
+			t.Errorf("test #%d should have err=%v from Eval, but err=%v", i+1, entry.err, err)
+		}
+
+		// FindAll is never lenient
+		if _, err := FindAll(expr, NewText(entry.text)); (err == nil) != (expr.Compile() == nil) {
+			t.Errorf("test #%d should have returned the compile error from FindAll, but err=%v", i+1, err)
+		}
+	}
+}
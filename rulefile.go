@@ -0,0 +1,281 @@
+package rematch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pixeltopic/rematch/internal/set"
+	"github.com/pixeltopic/rematch/internal/toml"
+)
+
+// Rule is an expression under a unique ID, along with metadata describing it.
+type Rule struct {
+	ID          string   `json:"id"`
+	Expr        string   `json:"expr"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Severity    string   `json:"severity,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Enabled     bool     `json:"enabled"` // true if omitted from a rule file
+	Line        int      `json:"-"`       // line of the rule in its file, starting from 1; 0 if unknown
+}
+
+// UnmarshalJSON unmarshals a rule, rejecting unknown fields. Enabled is true unless it is set.
+func (r *Rule) UnmarshalJSON(b []byte) error {
+	type plain Rule
+	p := plain{Enabled: true}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return err
+	}
+	*r = Rule(p)
+	return nil
+}
+
+// RuleFormat is the format of a rule file.
+type RuleFormat string
+
+// formats of a rule file
+const (
+	// RuleFormatJSON is an object with a "rules" array of rule objects:
+	//
+	//  {"rules": [{"id": "lunar-cow", "expr": "moon+cow", "tags": ["space"]}]}
+	RuleFormatJSON RuleFormat = "json"
+
+	// RuleFormatTOML is an array of tables named "rules":
+	//
+	//  [[rules]]
+	//  id = "lunar-cow"
+	//  expr = "moon+cow"
+	//  tags = ["space"]
+	//
+	// Strings of any kind, including multi-line ones, and arrays spanning several lines are supported;
+	// quoted and dotted keys, inline tables, floats and dates are not.
+	RuleFormatTOML RuleFormat = "toml"
+)
+
+// ruleFile is the JSON form of a rule file.
+type ruleFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// ParseRules parses the rules of a rule file. Expressions are not compiled; see CompileRules.
+//
+// Rules are written with the keys "id", "expr", "description", "tags", "severity", "owner" and "enabled",
+// of which only "id" and "expr" are required. Unknown keys are an error.
+func ParseRules(data []byte, format RuleFormat) ([]Rule, error) {
+	switch format {
+	case RuleFormatJSON:
+		return parseRulesJSON(data)
+	case RuleFormatTOML:
+		return parseRulesTOML(data)
+	}
+	return nil, fmt.Errorf("rematch: unknown rule format %q", format)
+}
+
+func parseRulesJSON(data []byte) ([]Rule, error) {
+	var file ruleFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		var (
+			serr *json.SyntaxError
+			terr *json.UnmarshalTypeError
+		)
+		switch {
+		case errors.As(err, &serr):
+			return nil, fmt.Errorf("rematch: line %d: %w", lineAt(data, serr.Offset), err)
+		case errors.As(err, &terr):
+			return nil, fmt.Errorf("rematch: line %d: %w", lineAt(data, terr.Offset), err)
+		}
+		return nil, fmt.Errorf("rematch: %w", err)
+	}
+	return file.Rules, nil
+}
+
+// lineAt returns the line of a byte offset in data, starting from 1.
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func parseRulesTOML(data []byte) ([]Rule, error) {
+	root, err := toml.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("rematch: %w", err)
+	}
+	for key := range root.Values {
+		if key != "rules" {
+			return nil, fmt.Errorf("rematch: unknown key %q", key)
+		}
+	}
+	tables, ok := root.Values["rules"].([]*toml.Table)
+	if _, exists := root.Values["rules"]; exists && !ok {
+		return nil, errors.New(`rematch: "rules" must be an array of tables`)
+	}
+
+	rules := make([]Rule, 0, len(tables))
+	for _, t := range tables {
+		r := Rule{Enabled: true, Line: t.Line}
+		for key, v := range t.Values {
+			var ok bool
+			switch key {
+			case "id":
+				r.ID, ok = v.(string)
+			case "expr":
+				r.Expr, ok = v.(string)
+			case "description":
+				r.Description, ok = v.(string)
+			case "severity":
+				r.Severity, ok = v.(string)
+			case "owner":
+				r.Owner, ok = v.(string)
+			case "enabled":
+				r.Enabled, ok = v.(bool)
+			case "tags":
+				r.Tags, ok = stringSlice(v)
+			default:
+				return nil, fmt.Errorf("rematch: line %d: unknown key %q", t.Line, key)
+			}
+			if !ok {
+				return nil, fmt.Errorf("rematch: line %d: invalid value of %q", t.Line, key)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// stringSlice returns v as a slice of strings, if it is an array of strings.
+func stringSlice(v interface{}) ([]string, bool) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, len(arr))
+	for i, elem := range arr {
+		if strs[i], ok = elem.(string); !ok {
+			return nil, false
+		}
+	}
+	return strs, true
+}
+
+// RuleError describes a rule that could not be added to a RuleSet.
+type RuleError struct {
+	ID    string // ID of the rule, if any
+	Index int    // position of the rule in its file, starting from 0
+	Line  int    // line of the rule in its file, starting from 1; 0 if unknown
+	Err   error  // a *ParseError if the expression of the rule is malformed
+}
+
+func (e *RuleError) Error() string {
+	pos := fmt.Sprintf("#%d", e.Index+1)
+	if e.Line > 0 {
+		pos = fmt.Sprintf("line %d", e.Line)
+	}
+	return fmt.Sprintf("rematch: rule %q (%s): %s", e.ID, pos, e.Err.Error())
+}
+
+// Unwrap returns the underlying error.
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// RuleErrors is every problem found with a collection of rules, in the order of the rules.
+type RuleErrors []*RuleError
+
+func (e RuleErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// CompileRules compiles every rule with opts and returns a RuleSet of the rules that are valid.
+//
+// Rather than stopping at the first invalid rule, it returns RuleErrors describing each problem with every rule:
+// a missing or duplicate ID, a missing expression, or a *ParseError for each problem with a malformed expression.
+// Rules that are not enabled are checked as well, but never match.
+func CompileRules(rules []Rule, opts ...ExprOption) (*RuleSet, error) {
+	var (
+		rs   = NewRuleSet()
+		ids  = set.NewStringSet() // including those of invalid rules
+		errs RuleErrors
+	)
+	for i, r := range rules {
+		fail := func(err error) {
+			errs = append(errs, &RuleError{ID: r.ID, Index: i, Line: r.Line, Err: err})
+		}
+		switch {
+		case r.ID == "":
+			fail(errors.New("missing ID"))
+			continue
+		case !ids.Add(r.ID):
+			fail(errors.New("duplicate ID"))
+			continue
+		case strings.TrimSpace(r.Expr) == "":
+			fail(errors.New("missing expression"))
+			continue
+		}
+		if perrs := Validate(r.Expr, opts...); len(perrs) > 0 {
+			for _, err := range perrs {
+				fail(err)
+			}
+			continue
+		}
+		if err := rs.AddRule(r, opts...); err != nil {
+			fail(err)
+		}
+	}
+	if len(errs) > 0 {
+		return rs, errs
+	}
+	return rs, nil
+}
+
+// ruleFormats are the formats of rule files by extension.
+var ruleFormats = map[string]RuleFormat{
+	".json": RuleFormatJSON,
+	".toml": RuleFormatTOML,
+}
+
+// LoadRules reads a rule file and compiles its rules with opts. The format of the file is chosen by its extension,
+// which is either ".json" or ".toml".
+//
+// Like CompileRules, it returns a RuleSet of the valid rules along with RuleErrors if any rules are invalid.
+// The errors are wrapped with the path of the file, so use errors.As to retrieve them.
+func LoadRules(path string, opts ...ExprOption) (*RuleSet, error) {
+	format, ok := ruleFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		exts := make([]string, 0, len(ruleFormats))
+		for ext := range ruleFormats {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		return nil, fmt.Errorf("rematch: %s: unknown rule file extension; expected one of %s", path, strings.Join(exts, ", "))
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("rematch: %w", err)
+	}
+	rules, err := ParseRules(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rs, err := CompileRules(rules, opts...)
+	if err != nil {
+		return rs, fmt.Errorf("%s: %w", path, err)
+	}
+	return rs, nil
+}
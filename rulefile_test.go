@@ -0,0 +1,191 @@
+package rematch
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testRulesJSON = `{
+  "rules": [
+    {"id": "lunar-cow", "expr": "cow+moon", "description": "cows in space", "tags": ["space", "animals"], "severity": "high", "owner": "farm"},
+    {"id": "market", "expr": "^\"farmers market\"", "enabled": false}
+  ]
+}`
+
+const testRulesTOML = `# rules for the farm
+[[rules]]
+id = "lunar-cow"
+expr = "cow+moon"
+description = "cows in space"
+tags = ["space", "animals"]
+severity = "high"
+owner = "farm"
+
+[[rules]]
+id = "market"
+expr = '^"farmers market"'
+enabled = false
+`
+
+func TestParseRules(t *testing.T) {
+	expected := []Rule{
+		{ID: "lunar-cow", Expr: "cow+moon", Description: "cows in space", Tags: []string{"space", "animals"}, Severity: "high", Owner: "farm", Enabled: true},
+		{ID: "market", Expr: `^"farmers market"`},
+	}
+
+	entries := []struct {
+		data   string
+		format RuleFormat
+		lines  []int
+	}{
+		{data: testRulesJSON, format: RuleFormatJSON, lines: []int{0, 0}},
+		{data: testRulesTOML, format: RuleFormatTOML, lines: []int{2, 10}},
+	}
+	for i, entry := range entries {
+		rules, err := ParseRules([]byte(entry.data), entry.format)
+		if err != nil {
+			t.Fatalf("test #%d should have err=nil, but err=%v", i+1, err)
+		}
+		for j := range expected {
+			expected[j].Line = entry.lines[j]
+		}
+		if !reflect.DeepEqual(rules, expected) {
+			t.Errorf("test #%d should have rules=%+v, but rules=%+v", i+1, expected, rules)
+		}
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	entries := []struct {
+		data   string
+		format RuleFormat
+	}{
+		{data: `{"rules": [{"id": "cow", "expr": "cow", "colour": "brown"}]}`, format: RuleFormatJSON},
+		{data: `{"rules": [{"id": "cow", "expr": 1}]}`, format: RuleFormatJSON},
+		{data: "{\"rules\": [\n{\"id\": \"cow\",}]}", format: RuleFormatJSON},
+		{data: "[[rules]]\nid = \"cow\"\ncolour = \"brown\"", format: RuleFormatTOML},
+		{data: "[[rules]]\nid = 1", format: RuleFormatTOML},
+		{data: "[[rules]]\ntags = [\"a\", 1]", format: RuleFormatTOML},
+		{data: "[rules]\nid = \"cow\"", format: RuleFormatTOML},
+		{data: "title = \"farm\"", format: RuleFormatTOML},
+		{data: "[[rules]]\nid = \"cow", format: RuleFormatTOML},
+		{data: "rules:", format: "yaml"},
+	}
+	for i, entry := range entries {
+		if _, err := ParseRules([]byte(entry.data), entry.format); err == nil {
+			t.Errorf("test #%d should have failed", i+1)
+		}
+	}
+}
+
+func TestCompileRules(t *testing.T) {
+	rules := []Rule{
+		{ID: "cow", Expr: "cow+moon", Enabled: true, Line: 1},
+		{ID: "off", Expr: "cow", Line: 2},
+		{ID: "", Expr: "cow", Enabled: true, Line: 3},
+		{ID: "cow", Expr: "moon", Enabled: true, Line: 4},
+		{ID: "empty", Expr: " ", Enabled: true, Line: 5},
+		{ID: "bad", Expr: "cow+(moon", Enabled: true, Line: 6},
+		{ID: "worse", Expr: "+cow+", Enabled: true, Line: 7},
+		{ID: "moon", Expr: "moon", Enabled: true},
+		{ID: "bad", Expr: "moon", Enabled: true, Line: 9}, // a duplicate even though the first is invalid
+	}
+
+	type ruleErr struct {
+		id     string
+		index  int
+		line   int
+		offset int // offset of a *ParseError; -1 if the error is not one
+	}
+	expected := []ruleErr{
+		{id: "", index: 2, line: 3, offset: -1},
+		{id: "cow", index: 3, line: 4, offset: -1},
+		{id: "empty", index: 4, line: 5, offset: -1},
+		{id: "bad", index: 5, line: 6, offset: 4},
+		{id: "worse", index: 6, line: 7, offset: 0},
+		{id: "worse", index: 6, line: 7, offset: 5},
+		{id: "bad", index: 8, line: 9, offset: -1},
+	}
+
+	rs, err := CompileRules(rules)
+	var errs RuleErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("should have RuleErrors, but err=%v", err)
+	}
+	var actual []ruleErr
+	for _, e := range errs {
+		offset := -1
+		var perr *ParseError
+		if errors.As(e, &perr) {
+			offset = perr.Offset
+		}
+		actual = append(actual, ruleErr{id: e.ID, index: e.Index, line: e.Line, offset: offset})
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("should have errs=%+v, but errs=%+v", expected, actual)
+	}
+
+	if rs.Len() != 3 {
+		t.Errorf("should have 3 rules, but has %d", rs.Len())
+	}
+	ids, _ := rs.Match(NewText("the cow jumped over the moon"))
+	if !reflect.DeepEqual(ids, []string{"cow", "moon"}) {
+		t.Errorf("should have matched [cow moon], but matched %v", ids)
+	}
+	if r, ok := rs.Rule("off"); !ok || r.Enabled || r.Line != 2 {
+		t.Errorf("should have rule off, but rule=%+v ok=%v", r, ok)
+	}
+	if _, ok := rs.Rule("bad"); ok {
+		t.Errorf("should not have rule bad")
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rematch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"rules.json": testRulesJSON,
+		"rules.TOML": testRulesTOML,
+		"bad.toml":   "[[rules]]\nid = \"bad\"\nexpr = \"cow+\"",
+		"rules.yaml": "rules:",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"rules.json", "rules.TOML"} {
+		rs, err := LoadRules(filepath.Join(dir, name), IgnoreCase())
+		if err != nil {
+			t.Fatalf("%s should have err=nil, but err=%v", name, err)
+		}
+		ids, _ := rs.Match(NewText("The COW jumped over the MOON at the Farmers Market"))
+		if !reflect.DeepEqual(ids, []string{"lunar-cow"}) {
+			t.Errorf("%s should have matched [lunar-cow], but matched %v", name, ids)
+		}
+		if r, ok := rs.Rule("lunar-cow"); !ok || r.Owner != "farm" || !reflect.DeepEqual(r.Tags, []string{"space", "animals"}) {
+			t.Errorf("%s should have metadata of lunar-cow, but rule=%+v", name, r)
+		}
+	}
+
+	rs, err := LoadRules(filepath.Join(dir, "bad.toml"))
+	var errs RuleErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].ID != "bad" || errs[0].Line != 1 || rs == nil || rs.Len() != 0 {
+		t.Errorf("bad.toml should have failed on rule bad, but err=%v", err)
+	}
+	if _, err := LoadRules(filepath.Join(dir, "rules.yaml")); err == nil {
+		t.Errorf("rules.yaml should have failed")
+	}
+	if _, err := LoadRules(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("missing.json should have failed")
+	}
+}
@@ -0,0 +1,232 @@
+package rematch
+
+import (
+	"fmt"
+
+	"github.com/pixeltopic/rematch/internal/set"
+)
+
+// rule is an expression in a RuleSet along with its ID.
+type rule struct {
+	id   string
+	expr *Expr
+	root Node
+	meta Rule
+}
+
+// RuleSet matches many expressions against a Text in one pass.
+//
+// Words, phrases and patterns shared between rules are matched once per Text, and each rule is indexed by a word
+// that must be present for it to match, so rules whose required words are absent from a Text are never evaluated.
+//
+// Rules must all be added before the set is used. Match and FindAll are then safe for concurrent use.
+type RuleSet struct {
+	rules  []*rule
+	ids    map[string]int   // index of each rule by ID
+	index  map[string][]int // required word key (see requiredKey) to indices of rules
+	always []int            // indices of rules without any required words; these are evaluated against every text
+}
+
+// NewRuleSet returns an empty RuleSet.
+func NewRuleSet() *RuleSet {
+	return &RuleSet{
+		ids:   map[string]int{},
+		index: map[string][]int{},
+	}
+}
+
+// Add compiles an expression and adds it to the set under a unique ID.
+func (rs *RuleSet) Add(id string, expr *Expr) error {
+	return rs.add(Rule{ID: id, Expr: expr.Raw(), Enabled: true}, expr)
+}
+
+// AddRule compiles the expression of a rule with opts and adds it to the set under its ID, along with its metadata.
+// A rule that is not enabled is kept so it can be looked up with Rule, but it never matches.
+func (rs *RuleSet) AddRule(r Rule, opts ...ExprOption) error {
+	return rs.add(r, NewExpr(r.Expr, opts...))
+}
+
+// Rule returns the rule added under an ID. A rule added with Add only has its ID, raw expression and Enabled set.
+func (rs *RuleSet) Rule(id string) (Rule, bool) {
+	i, ok := rs.ids[id]
+	if !ok {
+		return Rule{}, false
+	}
+	return rs.rules[i].meta, true
+}
+
+func (rs *RuleSet) add(meta Rule, expr *Expr) error {
+	id := meta.ID
+	if _, ok := rs.ids[id]; ok {
+		return fmt.Errorf("rematch: duplicate rule ID %q", id)
+	}
+	root, err := expr.compile()
+	if err != nil {
+		return err
+	}
+
+	i := len(rs.rules)
+	rs.ids[id] = i
+	rs.rules = append(rs.rules, &rule{id: id, expr: expr, root: root, meta: meta})
+	if !meta.Enabled {
+		return nil // a rule that is not indexed is never a candidate
+	}
+
+	// a rule only needs to be indexed by one of its required words; longer words are assumed to be rarer
+	var key string
+	for k := range requiredWords(root) {
+		if k := k.(string); len(k) > len(key) || (len(k) == len(key) && k < key) {
+			key = k
+		}
+	}
+	if key == "" {
+		rs.always = append(rs.always, i)
+		return nil
+	}
+	rs.index[key] = append(rs.index[key], i)
+	return nil
+}
+
+// Len returns the number of rules in the set, including those that are not enabled.
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// Match returns the IDs of every rule that matches text, in the order they were added.
+// Like Eval, each rule is only evaluated until its outcome is decided.
+func (rs *RuleSet) Match(text *Text) ([]string, error) {
+	var ids []string
+	cache := newOperandCache()
+	for _, i := range rs.candidates(text) {
+		if r := rs.rules[i]; matchNode(r.root, text, cache) {
+			ids = append(ids, r.id)
+		}
+	}
+	return ids, nil
+}
+
+// FindAll returns the result of every rule that matches text, keyed by rule ID.
+func (rs *RuleSet) FindAll(text *Text) (map[string]*Result, error) {
+	results := map[string]*Result{}
+	cache := newOperandCache()
+	for _, i := range rs.candidates(text) {
+		r := rs.rules[i]
+		if res := evalNode(r.root, text, cache); res.Match {
+			results[r.id] = res
+		}
+	}
+	return results, nil
+}
+
+// candidates returns the ascending indices of rules that may match text.
+func (rs *RuleSet) candidates(text *Text) []int {
+	var (
+		found = make([]bool, len(rs.rules))
+		out   []int
+	)
+	for _, i := range rs.always {
+		found[i] = true
+	}
+
+	// iterate over whichever of the index or the words of the text is smaller; words of the index must be looked up
+	// if they are folded to be found in the text
+	if len(rs.index) < len(text.positions) || text.confusables {
+		for key, rules := range rs.index {
+			if len(text.lookup(requiredWord(key))) == 0 {
+				continue
+			}
+			for _, i := range rules {
+				found[i] = true
+			}
+		}
+	} else {
+		for word := range text.positions {
+			for _, i := range rs.index[word] {
+				found[i] = true
+			}
+			for _, i := range rs.index[string(opFold)+foldCase(word)] {
+				found[i] = true
+			}
+		}
+	}
+
+	for i, ok := range found {
+		if ok {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// requiredKey returns the index key of a word. Case-insensitive words are keyed by their folded form and the case modifier.
+func requiredKey(word string, fold bool) string {
+	if fold {
+		return string(opFold) + foldCase(word)
+	}
+	return word
+}
+
+// requiredWord returns the word and whether it is case-insensitive from an index key.
+func requiredWord(key string) (string, bool) {
+	if key[0] == opFold {
+		return key[1:], true
+	}
+	return key, false
+}
+
+// requiredWords returns the index keys of words that must be present in a text for an expression to match.
+// An expression may match without any words present (for example, if it is negated or only contains patterns),
+// in which case the set is empty.
+func requiredWords(n Node) set.Set {
+	switch n := n.(type) {
+	case *NotNode:
+		// a negated expression may be true regardless of which words are present
+		return set.NewStringSet()
+	case *AndNode:
+		words := set.NewStringSet()
+		for _, c := range n.Nodes {
+			for k := range requiredWords(c) {
+				words.Add(k)
+			}
+		}
+		return words
+	case *NearNode:
+		words := requiredWords(n.Left)
+		for k := range requiredWords(n.Right) {
+			words.Add(k)
+		}
+		return words
+	case *OrNode:
+		var words set.Set
+		for _, c := range n.Nodes {
+			if words == nil {
+				words = requiredWords(c)
+				continue
+			}
+			both, other := set.NewStringSet(), requiredWords(c)
+			for k := range words {
+				if other.Contains(k) {
+					both.Add(k)
+				}
+			}
+			words = both
+		}
+		if words == nil {
+			return set.NewStringSet()
+		}
+		return words
+	case *WordNode:
+		if n.Edits > 0 {
+			// a fuzzy word may match any of many words
+			return set.NewStringSet()
+		}
+		return set.NewStringSet(requiredKey(n.Word, n.Fold))
+	case *PhraseNode:
+		words := set.NewStringSet()
+		for _, w := range n.Words {
+			words.Add(requiredKey(w, n.Fold))
+		}
+		return words
+	}
+	return set.NewStringSet()
+}
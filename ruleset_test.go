@@ -0,0 +1,144 @@
+package rematch
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testRule is an expression in a RuleSet under test.
+type testRule struct {
+	id       string
+	raw      string
+	required []string // index keys of words required by the rule
+}
+
+// testRuleSetEntry evaluates text against a RuleSet.
+type testRuleSetEntry struct {
+	text       string
+	ids        []string // IDs of rules that should match, in order
+	candidates []string // IDs of rules that should be evaluated, in order
+}
+
+func TestRuleSet(t *testing.T) {
+	rules := []testRule{
+		{id: "cow", raw: "cow+moon", required: []string{"cow", "moon"}},
+		{id: "either", raw: "cow|moon"},
+		{id: "both", raw: "(cow+farmer)|(cow+moon*)", required: []string{"cow"}},
+		{id: "phrase", raw: `^"Farmers Market"+!cow`, required: []string{"^farmers", "^market"}},
+		{id: "near", raw: "cow~4~^MOON", required: []string{"cow", "^moon"}},
+		{id: "not", raw: "!jolly"},
+		{id: "pattern", raw: "jump*", required: nil},
+		{id: "double", raw: "!!farmer", required: nil},
+		{id: "fuzzy", raw: "farmer~1+!cow", required: nil},
+	}
+
+	entries := []testRuleSetEntry{
+		{
+			text:       "The cow jumped over the moon",
+			ids:        []string{"cow", "either", "both", "near", "not", "pattern"},
+			candidates: []string{"cow", "either", "both", "near", "not", "pattern", "double", "fuzzy"},
+		},
+		{
+			text:       "at the farmers market",
+			ids:        []string{"phrase", "not", "fuzzy"},
+			candidates: []string{"either", "phrase", "not", "pattern", "double", "fuzzy"},
+		},
+		{
+			text:       "the jolly farmer",
+			ids:        []string{"double", "fuzzy"},
+			candidates: []string{"either", "not", "pattern", "double", "fuzzy"},
+		},
+	}
+
+	rs := NewRuleSet()
+	for _, r := range rules {
+		if err := rs.Add(r.id, NewExpr(r.raw)); err != nil {
+			t.Fatalf("rule %s should have err=nil, but err=%v", r.id, err)
+		}
+
+		expr := NewExpr(r.raw)
+		_ = expr.Compile()
+		var required []string
+		for k := range requiredWords(expr.AST()) {
+			required = append(required, k.(string))
+		}
+		if !testUnorderedSliceEq(required, r.required) {
+			t.Errorf("rule %s should require %v, but required %v", r.id, r.required, required)
+		}
+	}
+	if rs.Len() != len(rules) {
+		t.Errorf("should have len=%d, but len=%d", len(rules), rs.Len())
+	}
+
+	for i, entry := range entries {
+		text := NewText(entry.text)
+
+		var candidates []string
+		for _, j := range rs.candidates(text) {
+			candidates = append(candidates, rs.rules[j].id)
+		}
+		if !reflect.DeepEqual(candidates, entry.candidates) {
+			t.Errorf("test #%d should have candidates=%v, but candidates=%v", i+1, entry.candidates, candidates)
+		}
+
+		ids, err := rs.Match(text)
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		if !reflect.DeepEqual(ids, entry.ids) {
+			t.Errorf("test #%d should have ids=%v, but ids=%v", i+1, entry.ids, ids)
+		}
+
+		// results must be the same as evaluating each rule individually
+		results, err := rs.FindAll(text)
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+			continue
+		}
+		for _, r := range rules {
+			expected, _ := RawExprFindAll(r.raw, entry.text)
+			res, ok := results[r.id]
+			if ok != expected.Match {
+				t.Errorf("test #%d rule %s should have res=%v, but res=%v", i+1, r.id, expected.Match, ok)
+			} else if ok && (!testUnorderedSliceEq(res.Strings, expected.Strings) || !reflect.DeepEqual(res.Spans, expected.Spans)) {
+				t.Errorf("test #%d rule %s should have res=%v, but res=%v", i+1, r.id, expected, res)
+			}
+		}
+	}
+}
+
+func TestRuleSetAddErrors(t *testing.T) {
+	rs := NewRuleSet()
+	if err := rs.Add("a", NewExpr("cow")); err != nil {
+		t.Fatalf("should have err=nil, but err=%v", err)
+	}
+	if err := rs.Add("a", NewExpr("moon")); err == nil {
+		t.Errorf("should have failed to add a duplicate ID")
+	}
+	if err := rs.Add("b", NewExpr("cow+")); err == nil {
+		t.Errorf("should have failed to add a malformed expression")
+	}
+	if rs.Len() != 1 {
+		t.Errorf("should have len=1, but len=%d", rs.Len())
+	}
+}
+
+func BenchmarkRuleSet(b *testing.B) {
+	rs := NewRuleSet()
+	for i := 0; i < 5000; i++ {
+		n := strconv.Itoa(i)
+		if err := rs.Add(n, NewExpr("word"+n+"+(other"+n+"|prefix"+n+"*)")); err != nil {
+			b.Fatal(err)
+		}
+	}
+	text := NewText("a message mentioning word42, other42 and prefix4200")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rs.Match(text); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
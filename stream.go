@@ -0,0 +1,312 @@
+package rematch
+
+import (
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultWindow is the default look-behind of a stream in bytes.
+const defaultWindow = 16 << 10
+
+// StreamWindow sets the look-behind of EvalReader and FindAllReader to n bytes.
+//
+// A stream is matched in chunks of several windows, and the last window of each chunk is matched again along with
+// the next, so a pattern only matches if it fits in about n bytes. Words, phrases and proximity operators are not
+// limited by the window. A larger window finds longer pattern matches at the cost of memory and time.
+// It has no effect on NewText.
+func StreamWindow(n int) TextOption {
+	return func(c *textConfig) {
+		c.window = n
+	}
+}
+
+// EvalReader matches an expression against the text read from r, without holding all of it in memory.
+//
+// Reading stops as soon as the outcome is decided; for example, once every word of "cow+moon" has been read,
+// or once "cow" has been read for "!cow". Otherwise r is read until io.EOF.
+// Errors are returned as they are by Eval, along with any error from r other than io.EOF.
+func EvalReader(expr *Expr, r io.Reader, opts ...TextOption) (bool, error) {
+	root, err := expr.compile()
+	if err != nil {
+		if expr.lenient {
+			return false, nil
+		}
+		return false, err
+	}
+	res, err := newStream(root, opts, true).read(r)
+	if err != nil {
+		return false, err
+	}
+	return res.Match, nil
+}
+
+// FindAllReader matches an expression against the text read until io.EOF from r, without holding all of it in memory,
+// and returns all matched tokens if true.
+// Byte offsets of spans are relative to the start of the stream (after normalization by NormalizeText, if any).
+func FindAllReader(expr *Expr, r io.Reader, opts ...TextOption) (*Result, error) {
+	root, err := expr.compile()
+	if err != nil {
+		return nil, err
+	}
+	return newStream(root, opts, false).read(r)
+}
+
+// stream matches the tree of an expression against a text read in chunks, accumulating the matches of every operand.
+// It implements operands so the tree can be evaluated against everything read so far.
+type stream struct {
+	root   Node
+	cfg    textConfig
+	short  bool                       // only the outcome is needed, so matches are not accumulated and reading may stop early
+	leaves map[string]token           // distinct words, phrases and patterns by token
+	nears  []*NearNode                // proximity operators
+	words  int                        // words of look-behind needed to match every phrase and proximity operator across chunks
+	found  map[string]*operandMatch   // matches of each word, phrase and pattern so far, by token
+	forms  map[string]map[string]bool // distinct written forms of each word found, by token
+	close  map[*NearNode]bool         // proximity operators whose operands were found close enough
+}
+
+func newStream(root Node, opts []TextOption, short bool) *stream {
+	s := &stream{
+		root:   root,
+		short:  short,
+		leaves: map[string]token{},
+		found:  map[string]*operandMatch{},
+		forms:  map[string]map[string]bool{},
+		close:  map[*NearNode]bool{},
+	}
+	for _, opt := range opts {
+		opt(&s.cfg)
+	}
+	if s.cfg.window <= 0 {
+		s.cfg.window = defaultWindow
+	}
+
+	walk(root, func(n Node) {
+		switch n := n.(type) {
+		case *AndNode, *OrNode, *NotNode:
+		case *NearNode:
+			s.nears = append(s.nears, n)
+			if w := nodeWords(n.Left) + nodeWords(n.Right) + n.Distance; w > s.words {
+				s.words = w
+			}
+		default:
+			tok := leafToken(n)
+			s.leaves[tok.Str] = tok
+			s.found[tok.Str] = &operandMatch{}
+			s.forms[tok.Str] = map[string]bool{}
+			if w := nodeWords(n); w > s.words {
+				s.words = w
+			}
+		}
+	})
+	return s
+}
+
+// nodeWords returns the number of words matched by a word or phrase.
+func nodeWords(n Node) int {
+	if p, ok := n.(*PhraseNode); ok {
+		return len(p.Words)
+	}
+	return 1
+}
+
+// read matches the stream against the text read from r.
+func (s *stream) read(r io.Reader) (*Result, error) {
+	var (
+		chunk  = make([]byte, 4*s.cfg.window)
+		carry  []byte // end of the last chunk read, which may be part of a word
+		behind string // look-behind: end of the last window, already matched
+		base   int    // offset in the stream of the start of behind
+	)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return nil, err
+		}
+
+		data := append(carry, chunk[:n]...)
+		carry = nil
+		if !eof {
+			// a word must not be split between chunks, unless it is longer than a chunk
+			cut := wordBoundary(data, s.cfg)
+			if end := completeRunes(data); end-cut > len(chunk) {
+				cut = end
+			}
+			carry = append([]byte(nil), data[cut:]...)
+			data = data[:cut]
+		}
+
+		part := string(data)
+		if s.cfg.normalize != nil {
+			part = s.cfg.normalize(part)
+		}
+		text := newText(behind+part, s.cfg)
+		s.scan(text, base, len(behind))
+
+		if eof {
+			break
+		}
+		if s.short {
+			if _, known := s.decide(s.root); known {
+				break
+			}
+		}
+
+		start := s.lookBehind(text)
+		behind = text.Raw()[start:]
+		base += start
+	}
+	return evalOperands(s.root, s, s.short), nil
+}
+
+// wordBoundary returns the offset of the last character in data that cannot be part of a word.
+// If there is none, it returns len(data), excluding an incomplete character at the end of data.
+//
+// If the text is deobfuscated or split into words by a Tokenizer, that is the last whitespace, since words may then
+// be joined across punctuation and invisible characters, or contain them.
+func wordBoundary(data []byte, cfg textConfig) int {
+	end := completeRunes(data)
+	separates := func(r rune) bool { return !isAlphaNum(r) }
+	if cfg.deobfuscates() || cfg.tokenizer != nil {
+		separates = unicode.IsSpace
+	}
+	for i := end; i > 0; {
+		r, size := utf8.DecodeLastRune(data[:i])
+		if i -= size; separates(r) {
+			return i
+		}
+	}
+	return end // data is a single word, which is split rather than carried over indefinitely
+}
+
+// completeRunes returns len(data), excluding an incomplete character at the end of data.
+func completeRunes(data []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return len(data) - i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// lookBehind returns the offset in the raw string of text of the look-behind of the next window.
+// It covers at least the last window of bytes and the last words needed by phrases and proximity operators,
+// and never starts in the middle of a word.
+//
+// So that the look-behind does not grow with the stream, it is no longer than a window for each of those words
+// and a few more, even if that means it starts in the middle of a very long word.
+func (s *stream) lookBehind(text *Text) int {
+	start := len(text.raw) - s.cfg.window
+	if i := len(text.toks) - s.words; len(text.toks) > 0 {
+		if i < 0 {
+			i = 0 // every word read so far is needed
+		}
+		if text.toks[i].start < start {
+			start = text.toks[i].start
+		}
+	}
+	for _, tok := range text.toks {
+		if tok.start < start && start < tok.end {
+			start = tok.start
+			break
+		}
+	}
+
+	if limit := len(text.raw) - (4+s.words)*s.cfg.window; start < limit {
+		start = limit
+		for start < len(text.raw) && !utf8.RuneStart(text.raw[start]) {
+			start++
+		}
+	}
+	if start <= 0 {
+		return 0
+	}
+	return text.rawOffset(start)
+}
+
+// scan matches every operand against a window of text. Matches ending within the first behind bytes of text
+// were found in the previous window, so they are skipped. base is the offset of text in the stream.
+func (s *stream) scan(text *Text, base, behind int) {
+	for key, tok := range s.leaves {
+		found := s.found[key]
+		if s.short {
+			// matches found in the look-behind were found in the previous window, so any match will do
+			found.ok = found.ok || findOperand(tok, text, nil)
+			continue
+		}
+		m := matchOperand(tok, text, nil)
+		for i, span := range m.spans {
+			if span.End <= behind {
+				continue
+			}
+			found.ok = true
+			if tok.Phrase || tok.Regex {
+				found.strs = append(found.strs, m.strs[i])
+			} else if form := text.Raw()[span.Start:span.End]; !s.forms[key][form] {
+				// a word is reported once for each distinct way it is written
+				s.forms[key][form] = true
+				found.strs = append(found.strs, form)
+			}
+			span.Start += base
+			span.End += base
+			found.spans = append(found.spans, span)
+		}
+	}
+
+	for _, n := range s.nears {
+		if !s.close[n] && withinDistance(leafToken(n.Left), leafToken(n.Right), n.Distance, text) {
+			s.close[n] = true
+		}
+	}
+}
+
+// decide returns whether n matches the text read so far, and whether that is known regardless of what is read next.
+// Once an operand has been found, it is found regardless of what is read next, so only the absence of one is unknown.
+func (s *stream) decide(n Node) (ok, known bool) {
+	switch n := n.(type) {
+	case *AndNode:
+		known = true
+		for _, c := range n.Nodes {
+			cOK, cKnown := s.decide(c)
+			if cKnown && !cOK {
+				return false, true
+			}
+			known = known && cKnown
+		}
+		return known, known
+	case *OrNode:
+		known = true
+		for _, c := range n.Nodes {
+			cOK, cKnown := s.decide(c)
+			if cKnown && cOK {
+				return true, true
+			}
+			known = known && cKnown
+		}
+		return false, known
+	case *NotNode:
+		ok, known = s.decide(n.Node)
+		return !ok, known
+	case *NearNode:
+		return s.close[n], s.close[n]
+	}
+	ok = s.found[leafToken(n).Str].ok
+	return ok, ok
+}
+
+func (s *stream) match(tok token) *operandMatch {
+	return s.found[tok.Str]
+}
+
+func (s *stream) find(tok token) bool {
+	return s.found[tok.Str].ok
+}
+
+func (s *stream) near(n *NearNode) bool {
+	return s.close[n]
+}
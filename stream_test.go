@@ -0,0 +1,158 @@
+package rematch
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testStreamEntry matches an expression against a stream and compares the result with matching the whole text at once.
+type testStreamEntry struct {
+	in          string
+	text        string // matched instead of the text of the test, if not empty
+	shouldMatch bool
+}
+
+func TestFindAllReader(t *testing.T) {
+	text := strings.Repeat("The cow jumped over the moon. ", 5) +
+		"At the farmers market, a jolly café owner sold Moonshine to the farmer. " +
+		strings.Repeat("The dish ran away with the spoon! ", 5) + "Goodnight, moon."
+
+	entries := []testStreamEntry{
+		{in: "cow+moon", shouldMatch: true},
+		{in: "cow+!jolly", shouldMatch: false},
+		{in: `"farmers market"+"café owner"`, shouldMatch: true},
+		{in: `"the spoon goodnight"`, shouldMatch: false},
+		{in: `spoon~1~Goodnight`, shouldMatch: true},
+		{in: `cow~3~market`, shouldMatch: false},
+		{in: `^moonshine+^the_dish|cafe`, shouldMatch: true},
+		{in: "moon*+farm?r", shouldMatch: true},
+		{in: "Goodnight*moon+!(spoon+fork)", shouldMatch: true},
+		{in: "!!café", shouldMatch: true},
+		{in: "Godnight~1+^FARMERS~1", shouldMatch: true},
+		// more words apart than a small window holds
+		{in: "a~50~b", text: "a " + strings.Repeat("x ", 45) + "b", shouldMatch: true},
+		{in: `"a x"~50~b`, text: "a " + strings.Repeat("x ", 45) + "b", shouldMatch: true},
+	}
+
+	for i, entry := range entries {
+		text := text
+		if entry.text != "" {
+			text = entry.text
+		}
+		expr := NewExpr(entry.in)
+		expected, err := FindAll(expr, NewText(text))
+		if err != nil || expected.Match != entry.shouldMatch {
+			t.Fatalf("test #%d should have res=%v, but res=%v, err=%v", i+1, entry.shouldMatch, expected, err)
+		}
+
+		// a small window splits the text into many chunks
+		for _, window := range []int{5, 16, 1000} {
+			res, err := FindAllReader(expr, strings.NewReader(text), StreamWindow(window))
+			if err != nil {
+				t.Errorf("test #%d (window=%d) should have err=nil, but err=%v", i+1, window, err)
+			} else if res.Match != expected.Match {
+				t.Errorf("test #%d (window=%d) should have res=%v, but res=%v", i+1, window, expected.Match, res.Match)
+			} else if !testUnorderedSliceEq(res.Strings, expected.Strings) {
+				t.Errorf("test #%d (window=%d) should have res=%v, but res=%v", i+1, window, expected.Strings, res.Strings)
+			} else if !reflect.DeepEqual(res.Spans, expected.Spans) {
+				t.Errorf("test #%d (window=%d) should have spans=%v, but spans=%v", i+1, window, expected.Spans, res.Spans)
+			}
+
+			ok, err := EvalReader(expr, strings.NewReader(text), StreamWindow(window))
+			if err != nil || ok != expected.Match {
+				t.Errorf("test #%d (window=%d) should have res=%v, but res=%v, err=%v", i+1, window, expected.Match, ok, err)
+			}
+		}
+	}
+}
+
+// testErrReader returns err once all of r has been read.
+type testErrReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *testErrReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func TestEvalReader(t *testing.T) {
+	errRead := errors.New("read failed")
+	newReader := func(s string) io.Reader {
+		return &testErrReader{r: strings.NewReader(s), err: errRead}
+	}
+
+	// once decided, the rest of the stream is never read
+	if ok, err := EvalReader(NewExpr("cow|jolly*"), newReader("the cow jumped over the moon"), StreamWindow(4)); err != nil || !ok {
+		t.Errorf("should have res=true, but res=%v, err=%v", ok, err)
+	}
+	if ok, err := EvalReader(NewExpr("!cow"), newReader("the cow jumped over the moon"), StreamWindow(4)); err != nil || ok {
+		t.Errorf("should have res=false, but res=%v, err=%v", ok, err)
+	}
+
+	// undecided until the end of the stream
+	if _, err := EvalReader(NewExpr("cow+!jolly"), newReader("the cow jumped over the moon"), StreamWindow(4)); err != errRead {
+		t.Errorf("should have err=%v, but err=%v", errRead, err)
+	}
+	if _, err := FindAllReader(NewExpr("cow"), newReader("the cow jumped over the moon")); err != errRead {
+		t.Errorf("should have err=%v, but err=%v", errRead, err)
+	}
+
+	if _, err := EvalReader(NewExpr("cow+"), strings.NewReader("cow")); err == nil {
+		t.Errorf("should have failed to evaluate a malformed expression")
+	}
+	if ok, err := EvalReader(NewExpr("cow+", Lenient()), strings.NewReader("cow")); err != nil || ok {
+		t.Errorf("should have res=false, but res=%v, err=%v", ok, err)
+	}
+}
+
+func TestReaderLongWord(t *testing.T) {
+	// a word much longer than the window is split rather than held in memory, which would make matching quadratic
+	const n = 1 << 20
+	text := strings.Repeat("x", n) + " cow"
+	expected := []Span{{Start: n + 1, End: n + 4, Token: "cow", Kind: SpanWord}}
+
+	for i, opts := range [][]TextOption{
+		{StreamWindow(64)},
+		{StreamWindow(64), TokenizeText(UnicodeTokenizer)},
+		{StreamWindow(64), JoinSplitLetters()},
+	} {
+		res, err := FindAllReader(NewExpr("cow+!xx"), strings.NewReader(text), opts...)
+		if err != nil || !res.Match || !reflect.DeepEqual(res.Spans, expected) {
+			t.Errorf("test #%d should have spans=%v, but res=%+v, err=%v", i+1, expected, res, err)
+		}
+	}
+}
+
+func TestWordBoundary(t *testing.T) {
+	entries := []struct {
+		in  string
+		cfg textConfig
+		out int
+	}{
+		{in: "the cow", out: 3},
+		{in: "the cow ", out: 7},
+		{in: "cow", out: 3},
+		{in: " cow", out: 0},
+		{in: "the caf\xc3", out: 3},
+		{in: "café", out: 5},
+		{in: "caf\xc3", out: 3},
+		{in: "the h.a.t.e", out: 9},
+		{in: "the h.a.t.e", cfg: textConfig{join: true}, out: 3},
+		{in: "the h\u200bate", cfg: textConfig{confusables: true}, out: 3},
+		{in: "h.a.t.e", cfg: textConfig{join: true}, out: 7},
+		{in: "the don't", cfg: textConfig{tokenizer: UnicodeTokenizer}, out: 3},
+	}
+	for i, entry := range entries {
+		if out := wordBoundary([]byte(entry.in), entry.cfg); out != entry.out {
+			t.Errorf("test #%d should have out=%d, but out=%d", i+1, entry.out, out)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package rematch
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer splits a string into the words that the words and phrases of an expression are matched against.
+type Tokenizer interface {
+	// Words returns the start and end byte offsets in s of each word of s, in order.
+	// Words must not be empty or overlap; any that do are ignored. Words must not contain whitespace either,
+	// since a text read by EvalReader or FindAllReader may be split into chunks at any whitespace.
+	Words(s string) [][2]int
+}
+
+// TokenizerFunc adapts a function to a Tokenizer.
+type TokenizerFunc func(s string) [][2]int
+
+// Words returns f(s).
+func (f TokenizerFunc) Words(s string) [][2]int {
+	return f(s)
+}
+
+// AlphaNumTokenizer splits a string into runs of letters, digits and combining marks, so "don't" is split into
+// "don" and "t". It is how a Text is tokenized unless another Tokenizer is given to TokenizeText.
+var AlphaNumTokenizer Tokenizer = TokenizerFunc(alphaNumWords)
+
+// UnicodeTokenizer splits a string at the word boundaries of Unicode Standard Annex #29, keeping the words that contain
+// a letter or digit. Unlike AlphaNumTokenizer, it keeps apostrophes and periods between letters ("don't", "e.g"),
+// separators within numbers ("3.14", "1,000") and underscores ("snake_case") within words, and splits Chinese and
+// Japanese ideographs into words of one character. Words in Thai and other scripts that are written without spaces
+// are not segmented, which requires a dictionary.
+//
+// Since "_" is a wildcard in an expression, a word with an underscore must be quoted as a phrase: "snake_case".
+var UnicodeTokenizer Tokenizer = TokenizerFunc(unicodeWords)
+
+// TokenizeText splits a text into words with t rather than AlphaNumTokenizer.
+// Expressions matched against the text should be created with TokenizeExpr(t).
+func TokenizeText(t Tokenizer) TextOption {
+	return func(c *textConfig) {
+		c.tokenizer = t
+	}
+}
+
+// TokenizeExpr checks that every word of the expression, including the words of phrases, is a single word to t, so
+// that it can match a word of a text created with TokenizeText(t). Words may then contain any character other than
+// whitespace and operators, such as the apostrophe of "don't" for UnicodeTokenizer. Patterns are matched against the
+// raw text and are not affected.
+// A tokenizer is not included in the JSON form of an expression.
+func TokenizeExpr(t Tokenizer) ExprOption {
+	return func(e *Expr) {
+		e.tokenizer = t
+	}
+}
+
+// errNotWord is the problem with a word of an expression that is not a single word to its tokenizer.
+const errNotWord = SyntaxError("invalid word; must be a single word to the tokenizer")
+
+// isWord returns whether s is a single word to t.
+func isWord(t Tokenizer, s string) bool {
+	words := t.Words(s)
+	return len(words) == 1 && words[0] == [2]int{0, len(s)}
+}
+
+// tokenize splits s into word tokens with t, or with AlphaNumTokenizer if t is nil.
+func tokenize(s string, t Tokenizer) []textToken {
+	if t == nil {
+		return wordFields(s)
+	}
+	var (
+		toks []textToken
+		end  int
+	)
+	for _, w := range t.Words(s) {
+		if w[0] < end || w[1] <= w[0] || w[1] > len(s) {
+			continue
+		}
+		toks = append(toks, textToken{str: s[w[0]:w[1]], start: w[0], end: w[1]})
+		end = w[1]
+	}
+	return toks
+}
+
+func alphaNumWords(s string) [][2]int {
+	toks := wordFields(s)
+	words := make([][2]int, len(toks))
+	for i, tok := range toks {
+		words[i] = [2]int{tok.start, tok.end}
+	}
+	return words
+}
+
+// wordBreak is the Word_Break property of a character in Unicode Standard Annex #29, reduced to what unicodeWords needs.
+type wordBreak int
+
+// word break properties
+const (
+	wbOther wordBreak = iota
+	wbLetter
+	wbNumeric
+	wbKatakana
+	wbExtendNumLet
+	wbMidLetter
+	wbMidNum
+	wbMidNumLet
+	wbExtend    // includes Format and ZWJ
+	wbIdeograph // ideographs and hiragana, which the annex leaves to be split into words of one character
+)
+
+// wordBreakOf returns the word break property of r.
+func wordBreakOf(r rune) wordBreak {
+	switch r {
+	case ':', '\u00b7', '\u0387', '\u055f', '\u05f4', '\u2027', '\ufe13', '\ufe55', '\uff1a':
+		return wbMidLetter
+	case ',', ';', '\u037e', '\u0589', '\u060c', '\u060d', '\u066c', '\u07f8', '\u2044', '\ufe10', '\ufe14', '\ufe50', '\ufe54', '\uff0c', '\uff1b':
+		return wbMidNum
+	case '.', '\'', '\u2018', '\u2019', '\u2024', '\ufe52', '\uff07', '\uff0e':
+		return wbMidNumLet
+	case '\u30fc': // prolonged sound mark
+		return wbKatakana
+	}
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Cf):
+		return wbExtend
+	case unicode.In(r, unicode.Han, unicode.Hiragana):
+		return wbIdeograph
+	case unicode.Is(unicode.Katakana, r):
+		return wbKatakana
+	case unicode.IsLetter(r):
+		return wbLetter
+	case unicode.IsDigit(r):
+		return wbNumeric
+	case unicode.Is(unicode.Pc, r):
+		return wbExtendNumLet
+	}
+	return wbOther
+}
+
+// wordUnit is a character along with the characters that extend it, such as combining marks.
+type wordUnit struct {
+	wb         wordBreak
+	start, end int
+}
+
+// joins returns whether there is no word boundary between characters with the properties a and b,
+// ignoring the rules for characters between two others.
+func joins(a, b wordBreak) bool {
+	switch {
+	case (a == wbLetter || a == wbNumeric) && (b == wbLetter || b == wbNumeric): // WB5, WB8, WB9, WB10
+		return true
+	case a == wbKatakana && b == wbKatakana: // WB13
+		return true
+	case b == wbExtendNumLet: // WB13a
+		return a == wbLetter || a == wbNumeric || a == wbKatakana || a == wbExtendNumLet
+	case a == wbExtendNumLet: // WB13b
+		return b == wbLetter || b == wbNumeric || b == wbKatakana
+	}
+	return false
+}
+
+// joinsAcross returns whether there is no word boundary around a character with the property mid between characters
+// with the properties a and b.
+func joinsAcross(a, mid, b wordBreak) bool {
+	switch mid {
+	case wbMidLetter: // WB6, WB7
+		return a == wbLetter && b == wbLetter
+	case wbMidNum: // WB11, WB12
+		return a == wbNumeric && b == wbNumeric
+	case wbMidNumLet:
+		return (a == wbLetter && b == wbLetter) || (a == wbNumeric && b == wbNumeric)
+	}
+	return false
+}
+
+func unicodeWords(s string) [][2]int {
+	var units []wordUnit
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if wb := wordBreakOf(r); wb == wbExtend && len(units) > 0 { // WB4
+			units[len(units)-1].end = i + size
+		} else {
+			units = append(units, wordUnit{wb: wb, start: i, end: i + size})
+		}
+		i += size
+	}
+
+	var words [][2]int
+	for i := 0; i < len(units); {
+		switch units[i].wb {
+		case wbIdeograph:
+			words = append(words, [2]int{units[i].start, units[i].end})
+			i++
+			continue
+		case wbLetter, wbNumeric, wbKatakana, wbExtendNumLet:
+		default:
+			i++
+			continue
+		}
+
+		j := wordEnd(units, i)
+		for k := i; k <= j; k++ {
+			if units[k].wb != wbExtendNumLet {
+				// a word of underscores alone is not a word
+				words = append(words, [2]int{units[i].start, units[j].end})
+				break
+			}
+		}
+		i = j + 1
+	}
+	return words
+}
+
+// wordEnd returns the index of the last unit of the word starting at units[i].
+func wordEnd(units []wordUnit, i int) int {
+	for i+1 < len(units) {
+		a, b := units[i].wb, units[i+1].wb
+		switch {
+		case joins(a, b):
+			i++
+		case i+2 < len(units) && joinsAcross(a, b, units[i+2].wb):
+			i += 2
+		default:
+			return i
+		}
+	}
+	return i
+}
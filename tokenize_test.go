@@ -0,0 +1,140 @@
+package rematch
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// testWords returns the words of s to t.
+func testWords(t Tokenizer, s string) []string {
+	var words []string
+	for _, tok := range tokenize(s, t) {
+		words = append(words, tok.str)
+	}
+	return words
+}
+
+func TestUnicodeTokenizer(t *testing.T) {
+	entries := []struct {
+		in       string
+		expected []string
+	}{
+		{in: "The cow jumped over the moon.", expected: []string{"The", "cow", "jumped", "over", "the", "moon"}},
+		{in: "Don't stop, e.g. now", expected: []string{"Don't", "stop", "e.g", "now"}},
+		{in: "pi is 3.14, or 1,000.5 / 1000", expected: []string{"pi", "is", "3.14", "or", "1,000.5", "1000"}},
+		{in: "a well-known snake_case __init__ _", expected: []string{"a", "well", "known", "snake_case", "__init__"}},
+		{in: "l’été à Paris: café", expected: []string{"l’été", "à", "Paris", "café"}},
+		{in: "café naïve", expected: []string{"café", "naïve"}},
+		{in: "東京タワーへ行く", expected: []string{"東", "京", "タワー", "へ", "行", "く"}},
+		{in: "'quoted' ...dots... 3.", expected: []string{"quoted", "dots", "3"}},
+		{in: "", expected: nil},
+	}
+	for i, entry := range entries {
+		if words := testWords(UnicodeTokenizer, entry.in); !reflect.DeepEqual(words, entry.expected) {
+			t.Errorf("test #%d should have words=%q, but words=%q", i+1, entry.expected, words)
+		}
+	}
+
+	if words := testWords(AlphaNumTokenizer, "Don't stop"); !reflect.DeepEqual(words, []string{"Don", "t", "stop"}) {
+		t.Errorf("AlphaNumTokenizer should split at apostrophes, but words=%q", words)
+	}
+}
+
+// testCamelCase splits identifiers at underscores and at each upper case letter that follows a lower case letter.
+var testCamelCase = TokenizerFunc(func(s string) [][2]int {
+	var (
+		words [][2]int
+		start = -1
+		prev  rune
+	)
+	for i, r := range s + " " {
+		if start >= 0 && (!isAlphaNum(r) || (unicode.IsUpper(r) && unicode.IsLower(prev))) {
+			words = append(words, [2]int{start, i})
+			start = -1
+		}
+		if start < 0 && isAlphaNum(r) {
+			start = i
+		}
+		prev = r
+	}
+	return words
+})
+
+func TestTokenizer(t *testing.T) {
+	entries := []struct {
+		text        string
+		tokenizer   Tokenizer
+		expr        string
+		shouldMatch bool
+		strs        []string
+	}{
+		{text: "I don't know", tokenizer: UnicodeTokenizer, expr: "don't", shouldMatch: true, strs: []string{"don't"}},
+		{text: "I don't know", tokenizer: UnicodeTokenizer, expr: "don", shouldMatch: false},
+		{text: "I don't know", tokenizer: UnicodeTokenizer, expr: `"I don't"+!t`, shouldMatch: true, strs: []string{"I don't"}},
+		{text: "it is 3.14 or so", tokenizer: UnicodeTokenizer, expr: "3.14~2~so", shouldMatch: true},
+		{text: "it is 3.14 or so", tokenizer: UnicodeTokenizer, expr: "14", shouldMatch: false},
+		{text: "use snake_case", tokenizer: UnicodeTokenizer, expr: `"snake_case"`, shouldMatch: true, strs: []string{"snake_case"}},
+		{text: "use snake_case", tokenizer: UnicodeTokenizer, expr: "snake_case", shouldMatch: false}, // a wildcard, not a word
+		{text: "func parseHTTPRequest(raw_input string)", tokenizer: testCamelCase, expr: `"parse HTTPRequest"+input`, shouldMatch: true},
+		{text: "func parseHTTPRequest(raw_input string)", tokenizer: testCamelCase, expr: "^httprequest+raw", shouldMatch: true},
+		{text: "func parseHTTPRequest(raw_input string)", tokenizer: testCamelCase, expr: "parse*Request", shouldMatch: true},
+		{text: "func parseHTTPRequest(raw_input string)", tokenizer: testCamelCase, expr: "request", shouldMatch: false},
+		{text: strings.Repeat("x", 65530) + " don't z", tokenizer: UnicodeTokenizer, expr: "don", shouldMatch: false}, // split between chunks of a stream
+	}
+	for i, entry := range entries {
+		expr := NewExpr(entry.expr, TokenizeExpr(entry.tokenizer))
+		res, err := FindAll(expr, NewText(entry.text, TokenizeText(entry.tokenizer)))
+		if err != nil {
+			t.Errorf("test #%d should have err=nil, but err=%v", i+1, err)
+		} else if res.Match != entry.shouldMatch || (entry.strs != nil && !reflect.DeepEqual(res.Strings, entry.strs)) {
+			t.Errorf("test #%d should have match=%v strs=%q, but res=%+v", i+1, entry.shouldMatch, entry.strs, res)
+		}
+
+		ok, err := EvalReader(expr, strings.NewReader(entry.text), TokenizeText(entry.tokenizer))
+		if err != nil || ok != entry.shouldMatch {
+			t.Errorf("test #%d should have streamed match=%v, but match=%v, err=%v", i+1, entry.shouldMatch, ok, err)
+		}
+	}
+}
+
+func TestTokenizeExpr(t *testing.T) {
+	entries := []struct {
+		expr    string
+		offsets []int // offsets of every problem; nil if the expression is valid
+	}{
+		{expr: "don't+e.g+3.14"},
+		{expr: `"don't stop"|^L’été`},
+		{expr: "well-known", offsets: []int{0}},
+		{expr: "cow+moon.", offsets: []int{4}},
+		{expr: `"a well-known cow"+e.g.`, offsets: []int{3, 19}},
+		{expr: "don't*", offsets: []int{0}},
+		{expr: "cow+'", offsets: []int{4}},
+	}
+	for i, entry := range entries {
+		errs := Validate(entry.expr, TokenizeExpr(UnicodeTokenizer))
+		var offsets []int
+		for _, err := range errs {
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("test #%d should have a *ParseError, but err=%v", i+1, err)
+			}
+			offsets = append(offsets, perr.Offset)
+		}
+		if !reflect.DeepEqual(offsets, entry.offsets) {
+			t.Errorf("test #%d should have problems at %v, but errs=%v", i+1, entry.offsets, errs)
+		}
+
+		err := NewExpr(entry.expr, TokenizeExpr(UnicodeTokenizer)).Compile()
+		if (err == nil) != (entry.offsets == nil) {
+			t.Errorf("test #%d should have compiled=%v, but err=%v", i+1, entry.offsets == nil, err)
+		}
+	}
+
+	// without a tokenizer, words must be alphanumeric
+	if err := NewExpr("don't").Compile(); !errors.Is(err, SyntaxError("invalid char in word; must be alphanumeric")) {
+		t.Errorf("should have failed on the apostrophe, but err=%v", err)
+	}
+}